@@ -1,6 +1,7 @@
 package docker
 
 import (
+	"bytes"
 	"code.google.com/p/go.net/websocket"
 	"encoding/base64"
 	"encoding/json"
@@ -16,7 +17,6 @@ import (
 	"net"
 	"net/http"
 	"os"
-	"os/exec"
 	"regexp"
 	"strconv"
 	"strings"
@@ -150,11 +150,11 @@ func postContainersKill(srv *Server, version float64, w http.ResponseWriter, r *
 	signal := 0
 	if r != nil {
 		if s := r.Form.Get("signal"); s != "" {
-			s, err := strconv.Atoi(s)
+			s, err := utils.ParseSignal(s)
 			if err != nil {
 				return err
 			}
-			signal = s
+			signal = int(s)
 		}
 	}
 	if err := srv.ContainerKill(name, signal); err != nil {
@@ -177,6 +177,35 @@ func getContainersExport(srv *Server, version float64, w http.ResponseWriter, r
 	return nil
 }
 
+func getContainersVolumes(srv *Server, version float64, w http.ResponseWriter, r *http.Request, vars map[string]string) error {
+	if vars == nil {
+		return fmt.Errorf("Missing parameter")
+	}
+	if err := parseForm(r); err != nil {
+		return err
+	}
+	w.Header().Set("Content-Type", "application/x-tar")
+	return srv.ContainerVolumesExport(vars["name"], r.Form["path"], w)
+}
+
+func postContainersVolumes(srv *Server, version float64, w http.ResponseWriter, r *http.Request, vars map[string]string) error {
+	if vars == nil {
+		return fmt.Errorf("Missing parameter")
+	}
+	if err := parseForm(r); err != nil {
+		return err
+	}
+	keepDrivers, err := getBoolParam(r.Form.Get("keepdrivers"))
+	if err != nil {
+		return err
+	}
+	if err := srv.ContainerVolumesImport(vars["name"], r.Body, keepDrivers); err != nil {
+		return err
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
 func getImagesJSON(srv *Server, version float64, w http.ResponseWriter, r *http.Request, vars map[string]string) error {
 	if err := parseForm(r); err != nil {
 		return err
@@ -546,6 +575,34 @@ func postImagesLoad(srv *Server, version float64, w http.ResponseWriter, r *http
 	return srv.ImageLoad(r.Body)
 }
 
+func getContainersGet(srv *Server, version float64, w http.ResponseWriter, r *http.Request, vars map[string]string) error {
+	if vars == nil {
+		return fmt.Errorf("Missing parameter")
+	}
+	w.Header().Set("Content-Type", "application/x-tar")
+	return srv.ContainerSave(vars["name"], w)
+}
+
+func postContainersLoad(srv *Server, version float64, w http.ResponseWriter, r *http.Request, vars map[string]string) error {
+	if err := parseForm(r); err != nil {
+		return err
+	}
+	keepDrivers, err := getBoolParam(r.Form.Get("keepdrivers"))
+	if err != nil {
+		return err
+	}
+	container, err := srv.ContainerLoad(r.Form.Get("name"), r.Body, keepDrivers)
+	if err != nil {
+		return err
+	}
+	if version > 1.0 {
+		w.Header().Set("Content-Type", "application/json")
+	}
+	sf := utils.NewStreamFormatter(version > 1.0)
+	w.Write(sf.FormatStatus("", "%s", container.ID))
+	return nil
+}
+
 func postContainersCreate(srv *Server, version float64, w http.ResponseWriter, r *http.Request, vars map[string]string) error {
 	if err := parseForm(r); err != nil {
 		return nil
@@ -578,6 +635,14 @@ func postContainersCreate(srv *Server, version float64, w http.ResponseWriter, r
 		log.Println("WARNING: Your kernel does not support swap limit capabilities. Limitation discarded.")
 		out.Warnings = append(out.Warnings, "Your kernel does not support memory swap capabilities. Limitation discarded.")
 	}
+	if (job.Getenv("CpusetCpus") != "" || job.Getenv("CpusetMems") != "") && !srv.runtime.capabilities.CpusetLimit {
+		log.Println("WARNING: Your kernel does not support cpuset capabilities. Limitation discarded.")
+		out.Warnings = append(out.Warnings, "Your kernel does not support cpuset capabilities. Limitation discarded.")
+	}
+	if job.GetenvInt("BlkioWeight") > 0 && !srv.runtime.capabilities.BlkioWeight {
+		log.Println("WARNING: Your kernel does not support block IO weight capabilities. Limitation discarded.")
+		out.Warnings = append(out.Warnings, "Your kernel does not support block IO weight capabilities. Limitation discarded.")
+	}
 
 	if !job.GetenvBool("NetworkDisabled") && srv.runtime.capabilities.IPv4ForwardingDisabled {
 		log.Println("Warning: IPv4 forwarding is disabled.")
@@ -624,9 +689,13 @@ func deleteContainers(srv *Server, version float64, w http.ResponseWriter, r *ht
 		return err
 	}
 
-	if err := srv.ContainerDestroy(name, removeVolume, removeLink); err != nil {
+	warnings, err := srv.ContainerDestroy(name, removeVolume, removeLink)
+	if err != nil {
 		return err
 	}
+	if len(warnings) != 0 {
+		return writeJSON(w, http.StatusOK, &APIRm{Warnings: warnings})
+	}
 	w.WriteHeader(http.StatusNoContent)
 	return nil
 }
@@ -868,6 +937,66 @@ func getContainersByName(srv *Server, version float64, w http.ResponseWriter, r
 	return writeJSON(w, http.StatusOK, container)
 }
 
+func getVolumesJSON(srv *Server, version float64, w http.ResponseWriter, r *http.Request, vars map[string]string) error {
+	volumes, err := srv.Volumes()
+	if err != nil {
+		return err
+	}
+	return writeJSON(w, http.StatusOK, volumes)
+}
+
+func getVolumesByName(srv *Server, version float64, w http.ResponseWriter, r *http.Request, vars map[string]string) error {
+	if vars == nil {
+		return fmt.Errorf("Missing parameter")
+	}
+	volume, err := srv.VolumeInspect(vars["name"])
+	if err != nil {
+		return err
+	}
+	return writeJSON(w, http.StatusOK, volume)
+}
+
+func postVolumesCreate(srv *Server, version float64, w http.ResponseWriter, r *http.Request, vars map[string]string) error {
+	if err := parseForm(r); err != nil {
+		return err
+	}
+	volume, err := srv.VolumeCreate(r.Form.Get("name"), r.Form.Get("driver"))
+	if err != nil {
+		return err
+	}
+	return writeJSON(w, http.StatusCreated, volume)
+}
+
+func postVolumesPrune(srv *Server, version float64, w http.ResponseWriter, r *http.Request, vars map[string]string) error {
+	if err := parseForm(r); err != nil {
+		return err
+	}
+	all, err := getBoolParam(r.Form.Get("all"))
+	if err != nil {
+		return err
+	}
+	dryRun, err := getBoolParam(r.Form.Get("dryrun"))
+	if err != nil {
+		return err
+	}
+	out, err := srv.VolumesPrune(all, dryRun, r.Form["id"])
+	if err != nil {
+		return err
+	}
+	return writeJSON(w, http.StatusOK, out)
+}
+
+func deleteVolumes(srv *Server, version float64, w http.ResponseWriter, r *http.Request, vars map[string]string) error {
+	if vars == nil {
+		return fmt.Errorf("Missing parameter")
+	}
+	if err := srv.VolumeDestroy(vars["name"]); err != nil {
+		return err
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
 func getImagesByName(srv *Server, version float64, w http.ResponseWriter, r *http.Request, vars map[string]string) error {
 	if vars == nil {
 		return fmt.Errorf("Missing parameter")
@@ -896,6 +1025,8 @@ func postBuild(srv *Server, version float64, w http.ResponseWriter, r *http.Requ
 	rawSuppressOutput := r.FormValue("q")
 	rawNoCache := r.FormValue("nocache")
 	rawRm := r.FormValue("rm")
+	rawCheck := r.FormValue("check")
+	dockerfileName := r.FormValue("dockerfile")
 	repoName, tag := utils.ParseRepositoryTag(repoName)
 
 	var context io.Reader
@@ -903,20 +1034,13 @@ func postBuild(srv *Server, version float64, w http.ResponseWriter, r *http.Requ
 	if remoteURL == "" {
 		context = r.Body
 	} else if utils.IsGIT(remoteURL) {
-		if !strings.HasPrefix(remoteURL, "git://") {
-			remoteURL = "https://" + remoteURL
-		}
-		root, err := ioutil.TempDir("", "docker-build-git")
+		root, contextDir, err := cloneGitContext(parseGitURL(remoteURL))
 		if err != nil {
 			return err
 		}
 		defer os.RemoveAll(root)
 
-		if output, err := exec.Command("git", "clone", remoteURL, root).CombinedOutput(); err != nil {
-			return fmt.Errorf("Error trying to use git: %s (%s)", err, output)
-		}
-
-		c, err := archive.Tar(root, archive.Bzip2)
+		c, err := TarBuildContext(contextDir, dockerfileName, archive.Bzip2)
 		if err != nil {
 			return err
 		}
@@ -931,11 +1055,19 @@ func postBuild(srv *Server, version float64, w http.ResponseWriter, r *http.Requ
 		if err != nil {
 			return err
 		}
-		c, err := MkBuildContext(string(dockerFile), nil)
-		if err != nil {
-			return err
+		if archive.IsArchive(dockerFile) {
+			// The URL is an archive of the whole context
+			context = bytes.NewReader(dockerFile)
+		} else {
+			if dockerfileName != "" {
+				return fmt.Errorf("Bad parameter: dockerfile can't be used when the URL is a single Dockerfile")
+			}
+			c, err := MkBuildContext(string(dockerFile), nil)
+			if err != nil {
+				return err
+			}
+			context = c
 		}
-		context = c
 	}
 
 	suppressOutput, err := getBoolParam(rawSuppressOutput)
@@ -950,8 +1082,27 @@ func postBuild(srv *Server, version float64, w http.ResponseWriter, r *http.Requ
 	if err != nil {
 		return err
 	}
+	check, err := getBoolParam(rawCheck)
+	if err != nil {
+		return err
+	}
+
+	buildArgs := make(map[string]string)
+	for _, arg := range r.Form["buildarg"] {
+		parts := strings.SplitN(arg, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return fmt.Errorf("Bad parameter: invalid build argument %s, expected KEY=VALUE", arg)
+		}
+		buildArgs[parts[0]] = parts[1]
+	}
 
-	b := NewBuildFile(srv, utils.NewWriteFlusher(w), !suppressOutput, !noCache, rm)
+	b := NewBuildFile(srv, utils.NewWriteFlusher(w), !suppressOutput, !noCache, rm, buildArgs, dockerfileName)
+	if check {
+		if err := b.Check(context); err != nil {
+			return fmt.Errorf("Error check: %s", err)
+		}
+		return nil
+	}
 	id, err := b.Build(context)
 	if err != nil {
 		return fmt.Errorf("Error build: %s", err)
@@ -1054,10 +1205,14 @@ func createRouter(srv *Server, logging bool) (*mux.Router, error) {
 			"/containers/ps":                  getContainersJSON,
 			"/containers/json":                getContainersJSON,
 			"/containers/{name:.*}/export":    getContainersExport,
+			"/containers/{name:.*}/get":       getContainersGet,
 			"/containers/{name:.*}/changes":   getContainersChanges,
 			"/containers/{name:.*}/json":      getContainersByName,
 			"/containers/{name:.*}/top":       getContainersTop,
+			"/containers/{name:.*}/volumes":   getContainersVolumes,
 			"/containers/{name:.*}/attach/ws": wsContainersAttach,
+			"/volumes/json":                   getVolumesJSON,
+			"/volumes/{name:.*}/json":         getVolumesByName,
 		},
 		"POST": {
 			"/auth":                         postAuth,
@@ -1069,6 +1224,7 @@ func createRouter(srv *Server, logging bool) (*mux.Router, error) {
 			"/images/{name:.*}/push":        postImagesPush,
 			"/images/{name:.*}/tag":         postImagesTag,
 			"/containers/create":            postContainersCreate,
+			"/containers/load":              postContainersLoad,
 			"/containers/{name:.*}/kill":    postContainersKill,
 			"/containers/{name:.*}/restart": postContainersRestart,
 			"/containers/{name:.*}/start":   postContainersStart,
@@ -1077,10 +1233,14 @@ func createRouter(srv *Server, logging bool) (*mux.Router, error) {
 			"/containers/{name:.*}/resize":  postContainersResize,
 			"/containers/{name:.*}/attach":  postContainersAttach,
 			"/containers/{name:.*}/copy":    postContainersCopy,
+			"/containers/{name:.*}/volumes": postContainersVolumes,
+			"/volumes/create":               postVolumesCreate,
+			"/volumes/prune":                postVolumesPrune,
 		},
 		"DELETE": {
 			"/containers/{name:.*}": deleteContainers,
 			"/images/{name:.*}":     deleteImages,
+			"/volumes/{name:.*}":    deleteVolumes,
 		},
 		"OPTIONS": {
 			"": optionsHandler,
@@ -39,6 +39,8 @@ type (
 		NGoroutines        int         `json:",omitempty"`
 		MemoryLimit        bool        `json:",omitempty"`
 		SwapLimit          bool        `json:",omitempty"`
+		CpusetLimit        bool        `json:",omitempty"`
+		BlkioWeight        bool        `json:",omitempty"`
 		IPv4Forwarding     bool        `json:",omitempty"`
 		LXCVersion         string      `json:",omitempty"`
 		NEventsListener    int         `json:",omitempty"`
@@ -88,6 +90,10 @@ type (
 		Warnings []string `json:",omitempty"`
 	}
 
+	APIRm struct {
+		Warnings []string `json:",omitempty"`
+	}
+
 	APIPort struct {
 		PrivatePort int64
 		PublicPort  int64
@@ -118,6 +124,21 @@ type (
 		Resource string
 		HostPath string
 	}
+
+	APIVolume struct {
+		ID         string `json:"Id"`
+		Name       string `json:",omitempty"`
+		Driver     string
+		Created    int64
+		Path       string
+		Containers []string
+		Size       int64 `json:",omitempty"`
+	}
+
+	APIVolumesPrune struct {
+		Volumes        []APIVolume
+		SpaceReclaimed int64
+	}
 )
 
 func (api APIImages) ToLegacy() []APIImagesOld {
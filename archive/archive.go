@@ -59,6 +59,16 @@ func DetectCompression(source []byte) Compression {
 	return Uncompressed
 }
 
+// IsArchive returns true if source starts like a tar archive, compressed
+// or not.
+func IsArchive(source []byte) bool {
+	if DetectCompression(source) != Uncompressed {
+		return true
+	}
+	// The magic of POSIX tar headers is at offset 257
+	return len(source) >= 262 && string(source[257:262]) == "ustar"
+}
+
 func (compression *Compression) Flag() string {
 	switch *compression {
 	case Bzip2:
@@ -110,7 +120,7 @@ func escapeName(name string) string {
 // Tar creates an archive from the directory at `path`, only including files whose relative
 // paths are included in `filter`. If `filter` is nil, then all files are included.
 func TarFilter(path string, options *TarOptions) (io.Reader, error) {
-	args := []string{"tar", "--numeric-owner", "-f", "-", "-C", path, "-T", "-"}
+	args := []string{"tar", "--numeric-owner", "-f", "-", "-C", path}
 	if options.Includes == nil {
 		options.Includes = []string{"."}
 	}
@@ -123,6 +133,9 @@ func TarFilter(path string, options *TarOptions) (io.Reader, error) {
 	if !options.Recursive {
 		args = append(args, "--no-recursion")
 	}
+	// The file list comes last, as options like --no-recursion are
+	// positional for recent versions of tar
+	args = append(args, "-T", "-")
 
 	files := ""
 	for _, f := range options.Includes {
@@ -116,3 +116,30 @@ func TestTarUntar(t *testing.T) {
 		}
 	}
 }
+
+func TestIsArchive(t *testing.T) {
+	dir, err := ioutil.TempDir("", "docker-test-isarchive")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := ioutil.WriteFile(path.Join(dir, "Dockerfile"), []byte("FROM busybox\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, compression := range []Compression{Uncompressed, Gzip, Bzip2} {
+		archive, err := Tar(dir, compression)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := ioutil.ReadAll(archive)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !IsArchive(data) {
+			t.Fatalf("Expected an archive (%s) to be detected", compression.Extension())
+		}
+	}
+	if IsArchive([]byte("FROM busybox\nRUN true\n")) {
+		t.Fatal("Expected a Dockerfile not to be an archive")
+	}
+}
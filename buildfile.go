@@ -1,22 +1,30 @@
 package docker
 
 import (
+	"archive/tar"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"flag"
 	"fmt"
 	"github.com/dotcloud/docker/archive"
+	"github.com/dotcloud/docker/parser"
 	"github.com/dotcloud/docker/utils"
 	"io"
 	"io/ioutil"
 	"net/url"
 	"os"
 	"path"
-	"reflect"
 	"regexp"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
 )
 
 type BuildFile interface {
 	Build(io.Reader) (string, error)
+	Check(io.Reader) error
 	CmdFrom(string) error
 	CmdRun(string) error
 }
@@ -29,6 +37,8 @@ type buildFile struct {
 	maintainer   string
 	config       *Config
 	context      string
+	dockerfile   string // Path of the Dockerfile in the context
+	line         int    // Line of the Dockerfile being run
 	verbose      bool
 	utilizeCache bool
 	rm           bool
@@ -36,6 +46,19 @@ type buildFile struct {
 	tmpContainers map[string]struct{}
 	tmpImages     map[string]struct{}
 
+	// Images built by the previous stages, by index and by name
+	stages    map[string]string
+	stageN    int
+	stageName string
+
+	// Values of the build arguments given by the client, and KEY=value
+	// pairs of the ones declared in the current stage, or before the
+	// first FROM for FROM itself
+	buildArgs map[string]string
+	usedArgs  map[string]struct{}
+	args      []string
+	fromArgs  []string
+
 	out io.Writer
 }
 
@@ -47,8 +70,61 @@ func (b *buildFile) clearTmp(containers map[string]struct{}) {
 	}
 }
 
-func (b *buildFile) CmdFrom(name string) error {
-	image, err := b.runtime.repositories.LookupImage(name)
+// Names of build stages, which can't be taken for the index of a stage
+var validStageName = regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9_.-]*$`)
+
+// FROM <image> [AS <name>]
+func (b *buildFile) CmdFrom(args string) error {
+	tmp, err := parser.SplitWords(args)
+	if err != nil {
+		return err
+	}
+	if len(tmp) != 1 && (len(tmp) != 3 || !strings.EqualFold(tmp[1], "as")) {
+		return fmt.Errorf("Invalid FROM format")
+	}
+	// The arguments declared before the first FROM only apply to FROM
+	if b.stageN == 0 {
+		b.fromArgs = b.args
+	}
+	name, err := replaceEnvMatches(tmp[0], b.fromArgs)
+	if err != nil {
+		return err
+	}
+	if name == "" || strings.Contains(name, "$") {
+		return fmt.Errorf("Invalid FROM format: %s doesn't name an image", tmp[0])
+	}
+	stageName := ""
+	if len(tmp) == 3 {
+		stageName = tmp[2]
+		if _, err := strconv.Atoi(stageName); err == nil {
+			return fmt.Errorf("Invalid build stage name: %s, numbers are reserved for stage indexes", stageName)
+		}
+		if !validStageName.MatchString(stageName) {
+			return fmt.Errorf("Invalid build stage name: %s, only [a-zA-Z0-9_.-] are allowed, starting with a letter", stageName)
+		}
+		if _, exists := b.stages[stageName]; exists || stageName == b.stageName {
+			return fmt.Errorf("Conflict, the build stage name %s is already in use", stageName)
+		}
+	}
+
+	// Keep the result of the previous stage, if any, for the next ones
+	if b.stageN > 0 {
+		b.stages[strconv.Itoa(b.stageN-1)] = b.image
+		if b.stageName != "" {
+			b.stages[b.stageName] = b.image
+		}
+	}
+	b.stageN += 1
+	b.stageName = stageName
+	b.maintainer = ""
+	b.args = nil
+
+	var image *Image
+	if imageID, exists := b.stages[name]; exists {
+		image, err = b.runtime.graph.Get(imageID)
+	} else {
+		image, err = b.runtime.repositories.LookupImage(name)
+	}
 	if err != nil {
 		if b.runtime.graph.IsNotExist(err) {
 			remote, tag := utils.ParseRepositoryTag(name)
@@ -71,9 +147,37 @@ func (b *buildFile) CmdFrom(name string) error {
 	if b.config.Env == nil || len(b.config.Env) == 0 {
 		b.config.Env = append(b.config.Env, "HOME=/", "PATH=/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin")
 	}
+
+	// The triggers of the image run first, and are not inherited further
+	triggers := b.config.OnBuild
+	b.config.OnBuild = nil
+	if len(triggers) > 0 {
+		fmt.Fprintf(b.out, "# Executing %d build triggers\n", len(triggers))
+	}
+	for _, trigger := range triggers {
+		fmt.Fprintf(b.out, "Trigger: %s\n", trigger)
+		// The image may come from anywhere, check the trigger again
+		node, err := parser.ParseTrigger(b.line, trigger)
+		if err != nil {
+			return fmt.Errorf("Invalid build trigger: %s", err)
+		}
+		if err := b.dispatch(node); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
+// ONBUILD <instruction> <arguments>
+func (b *buildFile) CmdOnbuild(args string) error {
+	node, err := parser.ParseTrigger(b.line, args)
+	if err != nil {
+		return err
+	}
+	b.config.OnBuild = append(b.config.OnBuild, node.String())
+	return b.commit("", b.config.Cmd, fmt.Sprintf("ONBUILD %s", node))
+}
+
 func (b *buildFile) CmdMaintainer(name string) error {
 	b.maintainer = name
 	return b.commit("", b.config.Cmd, fmt.Sprintf("MAINTAINER %s", name))
@@ -83,16 +187,23 @@ func (b *buildFile) CmdRun(args string) error {
 	if b.image == "" {
 		return fmt.Errorf("Please provide a source image with `from` prior to run")
 	}
-	config, _, _, err := ParseRun([]string{b.image, "/bin/sh", "-c", args}, nil)
+	runCmd, err := b.parseCommand("RUN", args)
+	if err != nil {
+		return err
+	}
+	config, _, _, err := ParseRun(append([]string{b.image}, runCmd...), nil)
 	if err != nil {
 		return err
 	}
 
-	cmd := b.config.Cmd
+	cmd, env := b.config.Cmd, b.config.Env
 	b.config.Cmd = nil
 	MergeConfig(b.config, config)
 
-	defer func(cmd []string) { b.config.Cmd = cmd }(cmd)
+	// The build arguments are only given to the container, they are part
+	// of the cache key but not of the config of the image
+	b.config.Env = b.runEnv()
+	defer func(cmd, env []string) { b.config.Cmd, b.config.Env = cmd, env }(cmd, env)
 
 	utils.Debugf("Command to be executed: %v", b.config.Cmd)
 
@@ -113,6 +224,7 @@ func (b *buildFile) CmdRun(args string) error {
 	if err != nil {
 		return err
 	}
+	b.config.Env = env
 	if err := b.commit(cid, cmd, "run"); err != nil {
 		return err
 	}
@@ -130,7 +242,25 @@ func (b *buildFile) FindEnvKey(key string) int {
 	return -1
 }
 
+// runEnv returns the environment of the build containers: the environment
+// of the image, and the build arguments it doesn't override.
+func (b *buildFile) runEnv() []string {
+	env := append([]string{}, b.config.Env...)
+	for _, arg := range b.args {
+		if b.FindEnvKey(strings.SplitN(arg, "=", 2)[0]) < 0 {
+			env = append(env, arg)
+		}
+	}
+	return env
+}
+
 func (b *buildFile) ReplaceEnvMatches(value string) (string, error) {
+	return replaceEnvMatches(value, b.runEnv())
+}
+
+// replaceEnvMatches replaces the $KEY and ${KEY} of value with the values
+// of the KEY=value pairs of env
+func replaceEnvMatches(value string, env []string) (string, error) {
 	exp, err := regexp.Compile("(\\\\\\\\+|[^\\\\]|\\b|\\A)\\$({?)([[:alnum:]_]+)(}?)")
 	if err != nil {
 		return value, err
@@ -140,7 +270,7 @@ func (b *buildFile) ReplaceEnvMatches(value string) (string, error) {
 		match = match[strings.Index(match, "$"):]
 		matchKey := strings.Trim(match, "${}")
 
-		for _, envVar := range b.config.Env {
+		for _, envVar := range env {
 			envParts := strings.SplitN(envVar, "=", 2)
 			envKey := envParts[0]
 			envValue := envParts[1]
@@ -154,13 +284,53 @@ func (b *buildFile) ReplaceEnvMatches(value string) (string, error) {
 	return value, nil
 }
 
+var validArgName = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// ARG <name>[=<default value>]
+func (b *buildFile) CmdArg(args string) error {
+	tmp := strings.SplitN(strings.Trim(args, " \t"), "=", 2)
+	key := tmp[0]
+	if !validArgName.MatchString(key) {
+		return fmt.Errorf("Invalid ARG format")
+	}
+	b.usedArgs[key] = struct{}{}
+
+	value, exists := b.buildArgs[key]
+	if !exists && len(tmp) == 2 {
+		defaultValue, err := b.ReplaceEnvMatches(tmp[1])
+		if err != nil {
+			return err
+		}
+		value, exists = defaultValue, true
+	}
+	// Without a value, a stage gets the one given before the first FROM
+	if !exists && b.stageN > 0 {
+		for _, arg := range b.fromArgs {
+			if parts := strings.SplitN(arg, "=", 2); parts[0] == key {
+				value, exists = parts[1], true
+			}
+		}
+	}
+	for i, arg := range b.args {
+		if strings.SplitN(arg, "=", 2)[0] == key {
+			b.args = append(b.args[:i], b.args[i+1:]...)
+			break
+		}
+	}
+	// An argument without value is declared, but not set
+	if exists {
+		b.args = append(b.args, fmt.Sprintf("%s=%s", key, value))
+	}
+	return nil
+}
+
 func (b *buildFile) CmdEnv(args string) error {
-	tmp := strings.SplitN(args, " ", 2)
-	if len(tmp) != 2 {
+	i := strings.IndexAny(args, " \t")
+	if i < 0 {
 		return fmt.Errorf("Invalid ENV format")
 	}
-	key := strings.Trim(tmp[0], " \t")
-	value := strings.Trim(tmp[1], " \t")
+	key := args[:i]
+	value := strings.Trim(args[i+1:], " \t")
 
 	envKey := b.FindEnvKey(key)
 	replacedValue, err := b.ReplaceEnvMatches(value)
@@ -177,11 +347,24 @@ func (b *buildFile) CmdEnv(args string) error {
 	return b.commit("", b.config.Cmd, fmt.Sprintf("ENV %s", replacedVar))
 }
 
+// parseCommand parses the command given to RUN, CMD, ENTRYPOINT and
+// HEALTHCHECK. A JSON array of strings is the command to execute as is,
+// anything else is run with /bin/sh -c.
+func (b *buildFile) parseCommand(instruction, args string) ([]string, error) {
+	cmd, isJSON, err := parser.ParseCommand(instruction, args)
+	if err != nil {
+		return nil, &parser.Error{Line: b.line, Msg: fmt.Sprintf("%s %s", instruction, err)}
+	}
+	if !isJSON {
+		return []string{"/bin/sh", "-c", args}, nil
+	}
+	return cmd, nil
+}
+
 func (b *buildFile) CmdCmd(args string) error {
-	var cmd []string
-	if err := json.Unmarshal([]byte(args), &cmd); err != nil {
-		utils.Debugf("Error unmarshalling: %s, setting cmd to /bin/sh -c", err)
-		cmd = []string{"/bin/sh", "-c", args}
+	cmd, err := b.parseCommand("CMD", args)
+	if err != nil {
+		return err
 	}
 	if err := b.commit("", cmd, fmt.Sprintf("CMD %v", cmd)); err != nil {
 		return err
@@ -190,8 +373,56 @@ func (b *buildFile) CmdCmd(args string) error {
 	return nil
 }
 
+// HEALTHCHECK [OPTIONS] CMD command, or HEALTHCHECK NONE
+var healthcheckFormat = regexp.MustCompile(`(?i)^((?:\s*-\S+)*)\s*CMD\s+(.+)$`)
+
+func (b *buildFile) CmdHealthcheck(args string) error {
+	if strings.ToUpper(args) == "NONE" {
+		b.config.Healthcheck = &HealthConfig{Test: []string{"NONE"}}
+		return b.commit("", b.config.Cmd, "HEALTHCHECK NONE")
+	}
+	matches := healthcheckFormat.FindStringSubmatch(args)
+	if matches == nil {
+		return fmt.Errorf("Invalid HEALTHCHECK format")
+	}
+
+	cmd := flag.NewFlagSet("healthcheck", flag.ContinueOnError)
+	cmd.SetOutput(ioutil.Discard)
+	var (
+		flInterval = cmd.Duration("interval", 0, "")
+		flTimeout  = cmd.Duration("timeout", 0, "")
+		flRetries  = cmd.Int("retries", 0, "")
+	)
+	if err := cmd.Parse(strings.Fields(matches[1])); err != nil {
+		return fmt.Errorf("Invalid HEALTHCHECK option: %s", err)
+	}
+
+	test, err := b.parseCommand("HEALTHCHECK", matches[2])
+	if err != nil {
+		return err
+	}
+	b.config.Healthcheck = &HealthConfig{
+		Test:     test,
+		Interval: *flInterval,
+		Timeout:  *flTimeout,
+		Retries:  *flRetries,
+	}
+	return b.commit("", b.config.Cmd, fmt.Sprintf("HEALTHCHECK %s", args))
+}
+
+func (b *buildFile) CmdStopsignal(args string) error {
+	if _, err := utils.ParseSignal(args); err != nil {
+		return err
+	}
+	b.config.StopSignal = args
+	return b.commit("", b.config.Cmd, fmt.Sprintf("STOPSIGNAL %s", args))
+}
+
 func (b *buildFile) CmdExpose(args string) error {
-	ports := strings.Split(args, " ")
+	ports, err := parser.SplitWords(args)
+	if err != nil {
+		return err
+	}
 	b.config.PortSpecs = append(ports, b.config.PortSpecs...)
 	return b.commit("", b.config.Cmd, fmt.Sprintf("EXPOSE %v", ports))
 }
@@ -214,12 +445,11 @@ func (b *buildFile) CmdEntrypoint(args string) error {
 		return fmt.Errorf("Entrypoint cannot be empty")
 	}
 
-	var entrypoint []string
-	if err := json.Unmarshal([]byte(args), &entrypoint); err != nil {
-		b.config.Entrypoint = []string{"/bin/sh", "-c", args}
-	} else {
-		b.config.Entrypoint = entrypoint
+	entrypoint, err := b.parseCommand("ENTRYPOINT", args)
+	if err != nil {
+		return err
 	}
+	b.config.Entrypoint = entrypoint
 	if err := b.commit("", b.config.Cmd, fmt.Sprintf("ENTRYPOINT %s", args)); err != nil {
 		return err
 	}
@@ -252,12 +482,34 @@ func (b *buildFile) CmdVolume(args string) error {
 	return nil
 }
 
-func (b *buildFile) addRemote(container *Container, orig, dest string) error {
-	file, err := utils.Download(orig, ioutil.Discard)
+// downloadRemote downloads the source of an ADD from a URL to the file
+// at dest. The modification time of the file is reset, so that its
+// checksum only depends on its content.
+func (b *buildFile) downloadRemote(orig, dest string) error {
+	resp, err := utils.Download(orig, ioutil.Discard)
 	if err != nil {
 		return err
 	}
-	defer file.Body.Close()
+	defer resp.Body.Close()
+
+	file, err := os.Create(dest)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(file, resp.Body)
+	file.Close()
+	if err != nil {
+		return err
+	}
+	return os.Chtimes(dest, time.Unix(0, 0), time.Unix(0, 0))
+}
+
+func (b *buildFile) addRemote(container *Container, remotePath, orig, dest string) error {
+	file, err := os.Open(remotePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
 
 	// If the destination is a directory, figure out the filename.
 	if strings.HasSuffix(dest, "/") {
@@ -277,64 +529,189 @@ func (b *buildFile) addRemote(container *Container, orig, dest string) error {
 		dest = dest + filename
 	}
 
-	return container.Inject(file.Body, dest)
+	return container.Inject(file, dest)
 }
 
-func (b *buildFile) addContext(container *Container, orig, dest string) error {
+// checksum returns the checksum of the file or directory at origPath,
+// which identifies the content added by an ADD in the build cache. Unlike
+// utils.TarSum, it leaves out the modification times, which differ for the
+// same sources in every fresh clone or checkout.
+func checksum(origPath string) (string, error) {
+	fi, err := os.Stat(origPath)
+	if err != nil {
+		return "", err
+	}
+	var layer archive.Archive
+	if fi.IsDir() {
+		layer, err = archive.Tar(origPath, archive.Uncompressed)
+	} else {
+		layer, err = archive.TarFilter(path.Dir(origPath), &archive.TarOptions{
+			Compression: archive.Uncompressed,
+			Includes:    []string{path.Base(origPath)},
+			Recursive:   true,
+		})
+	}
+	if err != nil {
+		return "", err
+	}
+
+	// Sum each entry, then the sorted sums so that the order of the
+	// entries doesn't matter
+	var sums []string
+	tr := tar.NewReader(layer)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+		h := sha256.New()
+		fmt.Fprintf(h, "name%s\x00mode%o\x00uid%d\x00gid%d\x00typeflag%c\x00linkname%s\x00size%d\x00devmajor%d\x00devminor%d\x00",
+			path.Clean(hdr.Name), hdr.Mode, hdr.Uid, hdr.Gid, hdr.Typeflag, hdr.Linkname, hdr.Size, hdr.Devmajor, hdr.Devminor)
+		if _, err := io.Copy(h, tr); err != nil {
+			return "", err
+		}
+		sums = append(sums, hex.EncodeToString(h.Sum(nil)))
+	}
+	sort.Strings(sums)
+	h := sha256.New()
+	for _, sum := range sums {
+		io.WriteString(h, sum)
+	}
+	return "sha256:" + hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func (b *buildFile) contextPath(orig string) (string, error) {
 	origPath := path.Join(b.context, orig)
+	if !strings.HasPrefix(origPath, b.context) {
+		return "", fmt.Errorf("Forbidden path: %s", origPath)
+	}
+	if _, err := os.Stat(origPath); err != nil {
+		return "", fmt.Errorf("%s: no such file or directory", orig)
+	}
+	return origPath, nil
+}
+
+func (b *buildFile) addContext(container *Container, origPath, dest string, decompress bool) error {
 	destPath := path.Join(container.RootfsPath(), dest)
 	// Preserve the trailing '/'
 	if strings.HasSuffix(dest, "/") {
 		destPath = destPath + "/"
 	}
-	if !strings.HasPrefix(origPath, b.context) {
-		return fmt.Errorf("Forbidden path: %s", origPath)
-	}
 	fi, err := os.Stat(origPath)
 	if err != nil {
-		return fmt.Errorf("%s: no such file or directory", orig)
+		return err
 	}
 	if fi.IsDir() {
-		if err := archive.CopyWithTar(origPath, destPath); err != nil {
-			return err
+		return archive.CopyWithTar(origPath, destPath)
+	}
+	// First try to unpack the source as an archive
+	if decompress {
+		err := archive.UntarPath(origPath, destPath)
+		if err == nil {
+			return nil
 		}
-		// First try to unpack the source as an archive
-	} else if err := archive.UntarPath(origPath, destPath); err != nil {
 		utils.Debugf("Couldn't untar %s to %s: %s", origPath, destPath, err)
-		// If that fails, just copy it as a regular file
-		if err := os.MkdirAll(path.Dir(destPath), 0755); err != nil {
-			return err
-		}
-		if err := archive.CopyWithTar(origPath, destPath); err != nil {
-			return err
-		}
 	}
-	return nil
+	// If that fails, just copy it as a regular file
+	if err := os.MkdirAll(path.Dir(destPath), 0755); err != nil {
+		return err
+	}
+	return archive.CopyWithTar(origPath, destPath)
+}
+
+// stagePath returns the path of a file of the filesystem of a previous
+// build stage, given by name or index.
+func (b *buildFile) stagePath(stage, orig string) (string, error) {
+	imageID, exists := b.stages[stage]
+	if !exists {
+		return "", fmt.Errorf("No such build stage: %s", stage)
+	}
+	rootfs, err := b.runtime.graph.driver.Get(imageID)
+	if err != nil {
+		return "", fmt.Errorf("Driver %s failed to get image rootfs %s: %s", b.runtime.graph.driver, imageID, err)
+	}
+	// The symlinks of the stage point into its own filesystem, not the host's
+	origPath, err := utils.FollowSymlinkInScope(orig, rootfs)
+	if err != nil {
+		return "", err
+	}
+	if _, err := os.Stat(origPath); err != nil {
+		return "", fmt.Errorf("%s: no such file or directory in build stage %s", orig, stage)
+	}
+	return origPath, nil
 }
 
+// ADD [--from=<stage>] <src> <dest>
 func (b *buildFile) CmdAdd(args string) error {
-	if b.context == "" {
+	tmp, err := parser.SplitWords(args)
+	if err != nil {
+		return err
+	}
+	var stage string
+	if len(tmp) > 0 && strings.HasPrefix(tmp[0], "--from=") {
+		stage, tmp = strings.TrimPrefix(tmp[0], "--from="), tmp[1:]
+	} else if b.context == "" {
 		return fmt.Errorf("No context given. Impossible to use ADD")
 	}
-	tmp := strings.SplitN(args, " ", 2)
 	if len(tmp) != 2 {
 		return fmt.Errorf("Invalid ADD format")
 	}
 
-	orig, err := b.ReplaceEnvMatches(strings.Trim(tmp[0], " \t"))
+	orig, err := b.ReplaceEnvMatches(tmp[0])
 	if err != nil {
 		return err
 	}
 
-	dest, err := b.ReplaceEnvMatches(strings.Trim(tmp[1], " \t"))
+	dest, err := b.ReplaceEnvMatches(tmp[1])
 	if err != nil {
 		return err
 	}
 
+	// The checksum of the added content is part of the cache key
+	var origPath, sum string
+	if stage != "" {
+		if origPath, err = b.stagePath(stage, orig); err != nil {
+			return err
+		}
+		orig = fmt.Sprintf("--from=%s %s", stage, orig)
+	} else if utils.IsURL(orig) {
+		tmpDir, err := ioutil.TempDir("", "docker-build-remote")
+		if err != nil {
+			return err
+		}
+		defer os.RemoveAll(tmpDir)
+		origPath = path.Join(tmpDir, "remote")
+		if err := b.downloadRemote(orig, origPath); err != nil {
+			return err
+		}
+	} else if origPath, err = b.contextPath(orig); err != nil {
+		return err
+	}
+	if sum, err = checksum(origPath); err != nil {
+		return err
+	}
+
 	cmd := b.config.Cmd
-	b.config.Cmd = []string{"/bin/sh", "-c", fmt.Sprintf("#(nop) ADD %s in %s", orig, dest)}
+	b.config.Cmd = []string{"/bin/sh", "-c", fmt.Sprintf("#(nop) ADD %s in %s (%s)", orig, dest, sum)}
+	defer func(cmd []string) { b.config.Cmd = cmd }(cmd)
 
 	b.config.Image = b.image
+	if b.utilizeCache {
+		if cache, err := b.srv.ImageGetCached(b.image, b.config); err != nil {
+			return err
+		} else if cache != nil {
+			fmt.Fprintf(b.out, " ---> Using cache\n")
+			utils.Debugf("[BUILDER] Use cached version")
+			b.image = cache.ID
+			return nil
+		} else {
+			utils.Debugf("[BUILDER] Cache miss")
+		}
+	}
+
 	// Create the container and start it
 	container, _, err := b.runtime.Create(b.config, "")
 	if err != nil {
@@ -347,12 +724,17 @@ func (b *buildFile) CmdAdd(args string) error {
 	}
 	defer container.Unmount()
 
-	if utils.IsURL(orig) {
-		if err := b.addRemote(container, orig, dest); err != nil {
+	if stage != "" {
+		// Files from a stage are copied as is, archives are not unpacked
+		if err := b.addContext(container, origPath, dest, false); err != nil {
+			return err
+		}
+	} else if utils.IsURL(orig) {
+		if err := b.addRemote(container, origPath, orig, dest); err != nil {
 			return err
 		}
 	} else {
-		if err := b.addContext(container, orig, dest); err != nil {
+		if err := b.addContext(container, origPath, dest, true); err != nil {
 			return err
 		}
 	}
@@ -360,7 +742,6 @@ func (b *buildFile) CmdAdd(args string) error {
 	if err := b.commit(container.ID, cmd, fmt.Sprintf("ADD %s in %s", orig, dest)); err != nil {
 		return err
 	}
-	b.config.Cmd = cmd
 	return nil
 }
 
@@ -467,61 +848,114 @@ func (b *buildFile) commit(id string, autoCmd []string, comment string) error {
 	return nil
 }
 
-// Long lines can be split with a backslash
-var lineContinuation = regexp.MustCompile(`\s*\\\s*\n`)
+// removeIgnoredFiles removes the files of the build context at dir which
+// its .dockerignore file excludes, as the client may not have done it
+// (eg. for git contexts).
+func removeIgnoredFiles(dir, dockerfile string) error {
+	_, excluded, err := utils.WalkDockerIgnore(dir, dockerfile)
+	if err != nil {
+		return err
+	}
+	for _, relPath := range excluded {
+		if err := os.RemoveAll(path.Join(dir, relPath)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
 
-func (b *buildFile) Build(context io.Reader) (string, error) {
+// buildInstructions are the implementations of the instructions of a
+// Dockerfile, which the parser knows. It is filled by init, as FROM runs
+// the triggers of its image through it.
+var buildInstructions map[string]func(*buildFile, string) error
+
+func init() {
+	buildInstructions = map[string]func(*buildFile, string) error{
+		"ADD":         (*buildFile).CmdAdd,
+		"ARG":         (*buildFile).CmdArg,
+		"CMD":         (*buildFile).CmdCmd,
+		"COPY":        (*buildFile).CmdCopy,
+		"ENTRYPOINT":  (*buildFile).CmdEntrypoint,
+		"ENV":         (*buildFile).CmdEnv,
+		"EXPOSE":      (*buildFile).CmdExpose,
+		"FROM":        (*buildFile).CmdFrom,
+		"HEALTHCHECK": (*buildFile).CmdHealthcheck,
+		"INSERT":      (*buildFile).CmdInsert,
+		"MAINTAINER":  (*buildFile).CmdMaintainer,
+		"ONBUILD":     (*buildFile).CmdOnbuild,
+		"RUN":         (*buildFile).CmdRun,
+		"STOPSIGNAL":  (*buildFile).CmdStopsignal,
+		"USER":        (*buildFile).CmdUser,
+		"VOLUME":      (*buildFile).CmdVolume,
+		"WORKDIR":     (*buildFile).CmdWorkdir,
+	}
+}
+
+func (b *buildFile) dispatch(node *parser.Node) error {
+	handler, exists := buildInstructions[node.Instruction]
+	if !exists {
+		return &parser.Error{Line: node.Line, Msg: fmt.Sprintf("unknown instruction %s", node.Instruction)}
+	}
+	return handler(b, node.Args)
+}
+
+// parse unpacks the build context in a temporary directory, which the
+// caller must remove, and parses its Dockerfile.
+func (b *buildFile) parse(context io.Reader) ([]*parser.Node, error) {
 	// FIXME: @creack "name" is a terrible variable name
 	name, err := ioutil.TempDir("", "docker-build")
 	if err != nil {
-		return "", err
+		return nil, err
 	}
+	b.context = name
 	if err := archive.Untar(context, name, nil); err != nil {
-		return "", err
+		return nil, err
 	}
-	defer os.RemoveAll(name)
-	b.context = name
-	filename := path.Join(name, "Dockerfile")
-	if _, err := os.Stat(filename); os.IsNotExist(err) {
-		return "", fmt.Errorf("Can't build a directory with no Dockerfile")
+	if err := removeIgnoredFiles(name, b.dockerfile); err != nil {
+		return nil, err
 	}
-	fileBytes, err := ioutil.ReadFile(filename)
-	if err != nil {
-		return "", err
+	filename := path.Join(name, b.dockerfile)
+	if !strings.HasPrefix(filename, name+"/") {
+		return nil, fmt.Errorf("Forbidden path: %s", b.dockerfile)
 	}
-	dockerfile := string(fileBytes)
-	dockerfile = lineContinuation.ReplaceAllString(dockerfile, "")
-	stepN := 0
-	for _, line := range strings.Split(dockerfile, "\n") {
-		line = strings.Trim(strings.Replace(line, "\t", " ", -1), " \t\r\n")
-		// Skip comments and empty line
-		if len(line) == 0 || line[0] == '#' {
-			continue
-		}
-		tmp := strings.SplitN(line, " ", 2)
-		if len(tmp) != 2 {
-			return "", fmt.Errorf("Invalid Dockerfile format")
-		}
-		instruction := strings.ToLower(strings.Trim(tmp[0], " "))
-		arguments := strings.Trim(tmp[1], " ")
-
-		method, exists := reflect.TypeOf(b).MethodByName("Cmd" + strings.ToUpper(instruction[:1]) + strings.ToLower(instruction[1:]))
-		if !exists {
-			fmt.Fprintf(b.out, "# Skipping unknown instruction %s\n", strings.ToUpper(instruction))
-			continue
+	f, err := os.Open(filename)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("Can't build a directory with no %s", b.dockerfile)
 		}
+		return nil, err
+	}
+	defer f.Close()
+	return parser.Parse(f)
+}
 
-		stepN += 1
-		fmt.Fprintf(b.out, "Step %d : %s %s\n", stepN, strings.ToUpper(instruction), arguments)
+func (b *buildFile) Build(context io.Reader) (string, error) {
+	nodes, err := b.parse(context)
+	defer os.RemoveAll(b.context)
+	if err != nil {
+		return "", err
+	}
+	for stepN, node := range nodes {
+		b.line = node.Line
+		fmt.Fprintf(b.out, "Step %d : %s\n", stepN+1, node)
 
-		ret := method.Func.Call([]reflect.Value{reflect.ValueOf(b), reflect.ValueOf(arguments)})[0].Interface()
-		if ret != nil {
-			return "", ret.(error)
+		if err := b.dispatch(node); err != nil {
+			return "", err
 		}
 
 		fmt.Fprintf(b.out, " ---> %v\n", utils.TruncateID(b.image))
 	}
 	if b.image != "" {
+		var unused []string
+		for key := range b.buildArgs {
+			if _, exists := b.usedArgs[key]; !exists {
+				unused = append(unused, key)
+			}
+		}
+		if len(unused) > 0 {
+			sort.Strings(unused)
+			fmt.Fprintf(b.out, "[Warning] Build arguments not declared by an ARG instruction: %s\n", strings.Join(unused, ", "))
+		}
 		fmt.Fprintf(b.out, "Successfully built %s\n", utils.TruncateID(b.image))
 		if b.rm {
 			b.clearTmp(b.tmpContainers)
@@ -531,14 +965,49 @@ func (b *buildFile) Build(context io.Reader) (string, error) {
 	return "", fmt.Errorf("An error occurred during the build\n")
 }
 
-func NewBuildFile(srv *Server, out io.Writer, verbose, utilizeCache, rm bool) BuildFile {
+// Check parses the Dockerfile of the context and reports its errors,
+// without running anything.
+func (b *buildFile) Check(context io.Reader) error {
+	nodes, err := b.parse(context)
+	defer os.RemoveAll(b.context)
+	if err != nil {
+		return err
+	}
+	if len(nodes) == 0 {
+		return fmt.Errorf("The Dockerfile has no instructions")
+	}
+	// As on build, only ARG may come before the first FROM, which they
+	// are replaced in
+	for i, node := range nodes {
+		if node.Instruction == "FROM" {
+			break
+		}
+		if node.Instruction != "ARG" || i == len(nodes)-1 {
+			return &parser.Error{Line: node.Line, Msg: "the first instruction must be FROM, after ARG if any"}
+		}
+	}
+	for _, node := range nodes {
+		fmt.Fprintf(b.out, "Line %d : %s\n", node.Line, node)
+	}
+	fmt.Fprintf(b.out, "Dockerfile OK, %d instructions\n", len(nodes))
+	return nil
+}
+
+func NewBuildFile(srv *Server, out io.Writer, verbose, utilizeCache, rm bool, buildArgs map[string]string, dockerfile string) BuildFile {
+	if dockerfile == "" {
+		dockerfile = "Dockerfile"
+	}
 	return &buildFile{
 		runtime:       srv.runtime,
 		srv:           srv,
 		config:        &Config{},
+		dockerfile:    dockerfile,
 		out:           out,
 		tmpContainers: make(map[string]struct{}),
 		tmpImages:     make(map[string]struct{}),
+		stages:        make(map[string]string),
+		buildArgs:     buildArgs,
+		usedArgs:      make(map[string]struct{}),
 		verbose:       verbose,
 		utilizeCache:  utilizeCache,
 		rm:            rm,
@@ -0,0 +1,101 @@
+package docker
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// parseGitURL splits the URL of a git build context, repository#ref:subdir,
+// into the repository to clone, the branch, tag or commit to check out and
+// the directory of the repository to use as context. The ref and the
+// directory are optional.
+func parseGitURL(remoteURL string) (repository, ref, subdir string) {
+	repository = remoteURL
+	if i := strings.Index(remoteURL, "#"); i >= 0 {
+		repository, ref = remoteURL[:i], remoteURL[i+1:]
+		if j := strings.Index(ref, ":"); j >= 0 {
+			ref, subdir = ref[:j], ref[j+1:]
+		}
+	}
+	if !strings.HasPrefix(repository, "git://") {
+		repository = "https://" + repository
+	}
+	return repository, ref, subdir
+}
+
+func git(dir string, args ...string) ([]byte, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	return cmd.CombinedOutput()
+}
+
+// cloneGitContext clones a git repository in a temporary directory, which
+// the caller must remove, and checks out the given ref, if any. It returns
+// the directory and the path of the build context in it.
+func cloneGitContext(repository, ref, subdir string) (string, string, error) {
+	root, err := ioutil.TempDir("", "docker-build-git")
+	if err != nil {
+		return "", "", err
+	}
+	if output, err := git("", "clone", repository, root); err != nil {
+		os.RemoveAll(root)
+		return "", "", fmt.Errorf("Error trying to use git: %s (%s)", err, output)
+	}
+
+	if ref != "" {
+		// Branches other than the default one only exist on the remote
+		var commit []byte
+		for _, name := range []string{ref, "origin/" + ref} {
+			if commit, err = git(root, "rev-parse", "--verify", "--quiet", name+"^{commit}"); err == nil {
+				break
+			}
+		}
+		if err != nil {
+			os.RemoveAll(root)
+			return "", "", fmt.Errorf("No such branch, tag or commit %s in git repository %s", ref, repository)
+		}
+		if output, err := git(root, "checkout", "--quiet", strings.TrimSpace(string(commit))); err != nil {
+			os.RemoveAll(root)
+			return "", "", fmt.Errorf("Error trying to use git: %s (%s)", err, output)
+		}
+	}
+
+	contextDir, err := resolveGitContext(root, subdir)
+	if err != nil {
+		os.RemoveAll(root)
+		if os.IsNotExist(err) {
+			return "", "", fmt.Errorf("No such directory %s in git repository %s", subdir, repository)
+		}
+		return "", "", err
+	}
+	if fi, err := os.Stat(contextDir); err != nil || !fi.IsDir() {
+		os.RemoveAll(root)
+		return "", "", fmt.Errorf("No such directory %s in git repository %s", subdir, repository)
+	}
+	return root, contextDir, nil
+}
+
+// resolveGitContext returns the directory subdir of the clone root with
+// its symlinks resolved, as the repository can link outside of the clone.
+func resolveGitContext(root, subdir string) (string, error) {
+	if contextDir := path.Join(root, subdir); contextDir != root && !strings.HasPrefix(contextDir, root+"/") {
+		return "", fmt.Errorf("Forbidden path: %s", subdir)
+	}
+	root, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		return "", err
+	}
+	contextDir, err := filepath.EvalSymlinks(path.Join(root, subdir))
+	if err != nil {
+		return "", err
+	}
+	if contextDir != root && !strings.HasPrefix(contextDir, root+"/") {
+		return "", fmt.Errorf("Forbidden path: %s", subdir)
+	}
+	return contextDir, nil
+}
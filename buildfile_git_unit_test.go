@@ -0,0 +1,111 @@
+package docker
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path"
+	"testing"
+)
+
+func TestParseGitURL(t *testing.T) {
+	for remoteURL, expected := range map[string][3]string{
+		"github.com/dotcloud/docker":                {"https://github.com/dotcloud/docker", "", ""},
+		"git://host/repo#v1.0":                      {"git://host/repo", "v1.0", ""},
+		"git://host/repo#branch:services/worker":    {"git://host/repo", "branch", "services/worker"},
+		"github.com/dotcloud/docker#:docs/sources/": {"https://github.com/dotcloud/docker", "", "docs/sources/"},
+	} {
+		repository, ref, subdir := parseGitURL(remoteURL)
+		if [3]string{repository, ref, subdir} != expected {
+			t.Errorf("Expected %s to be parsed as %v, got %v", remoteURL, expected, [3]string{repository, ref, subdir})
+		}
+	}
+}
+
+func TestCloneGitContext(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	repository, err := ioutil.TempDir("", "docker-test-git")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(repository)
+
+	commit := func(file, content string) {
+		if err := os.MkdirAll(path.Join(repository, path.Dir(file)), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path.Join(repository, file), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		for _, args := range [][]string{{"add", "-A"}, {"-c", "user.name=test", "-c", "user.email=test@docker.io", "commit", "-q", "-m", file}} {
+			if output, err := git(repository, args...); err != nil {
+				t.Fatalf("%s (%s)", err, output)
+			}
+		}
+	}
+	for _, args := range [][]string{{"init", "-q"}, {"checkout", "-q", "-b", "master"}} {
+		if output, err := git(repository, args...); err != nil {
+			t.Fatalf("%s (%s)", err, output)
+		}
+	}
+	commit("Dockerfile", "from busybox\n")
+	if output, err := git(repository, "tag", "v1"); err != nil {
+		t.Fatalf("%s (%s)", err, output)
+	}
+	firstCommit, err := git(repository, "rev-parse", "HEAD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if output, err := git(repository, "checkout", "-q", "-b", "worker"); err != nil {
+		t.Fatalf("%s (%s)", err, output)
+	}
+	commit("worker/Dockerfile", "from busybox\nrun true\n")
+	if output, err := git(repository, "checkout", "-q", "-b", "links", "master"); err != nil {
+		t.Fatalf("%s (%s)", err, output)
+	}
+	for link, target := range map[string]string{"etc": "/etc", "docs": "worker", "parent": ".."} {
+		if err := os.Symlink(target, path.Join(repository, link)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	commit("worker/Dockerfile", "from busybox\n")
+	if output, err := git(repository, "checkout", "-q", "master"); err != nil {
+		t.Fatalf("%s (%s)", err, output)
+	}
+
+	for _, test := range []struct {
+		ref, subdir, file string
+		exists            bool
+	}{
+		{"", "", "Dockerfile", true},
+		{"", "", "worker/Dockerfile", false},
+		{"worker", "worker", "Dockerfile", true},
+		{"v1", "", "worker/Dockerfile", false},
+		{string(firstCommit[:12]), "", "Dockerfile", true},
+		{"links", "docs", "Dockerfile", true},
+	} {
+		root, contextDir, err := cloneGitContext(repository, test.ref, test.subdir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := os.Stat(path.Join(contextDir, test.file)); (err == nil) != test.exists {
+			t.Errorf("Expected %s to exist in %s:%s: %t", test.file, test.ref, test.subdir, test.exists)
+		}
+		os.RemoveAll(root)
+	}
+
+	if _, _, err := cloneGitContext(repository, "nonexistent", ""); err == nil || err.Error() != "No such branch, tag or commit nonexistent in git repository "+repository {
+		t.Fatalf("Expected a missing ref to be reported, got %v", err)
+	}
+	if _, _, err := cloneGitContext(repository, "master", "worker"); err == nil || err.Error() != "No such directory worker in git repository "+repository {
+		t.Fatalf("Expected a missing directory to be reported, got %v", err)
+	}
+	// A directory outside of the clone is forbidden, even through a symlink
+	for _, subdir := range []string{"../..", "etc", "parent"} {
+		if _, _, err := cloneGitContext(repository, "links", subdir); err == nil || err.Error() != "Forbidden path: "+subdir {
+			t.Fatalf("Expected %s outside of the repository to be forbidden, got %v", subdir, err)
+		}
+	}
+}
@@ -0,0 +1,224 @@
+package docker
+
+import (
+	"github.com/dotcloud/docker/archive"
+	"github.com/dotcloud/docker/parser"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// tempBuildContext creates a build context with the given .dockerignore
+func tempBuildContext(t *testing.T, dockerignore string) string {
+	dir, err := ioutil.TempDir("", "docker-test-context")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range []string{"Dockerfile", ".dockerignore", "main.go", "app.log", ".git/config", "docs/index.md", "docs/README.md"} {
+		if err := os.MkdirAll(path.Join(dir, path.Dir(file)), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path.Join(dir, file), []byte(file), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := ioutil.WriteFile(path.Join(dir, ".dockerignore"), []byte(dockerignore), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func listFiles(dir string) string {
+	var files []string
+	for _, file := range []string{"Dockerfile", ".dockerignore", "main.go", "app.log", ".git/config", "docs/index.md", "docs/README.md"} {
+		if _, err := os.Stat(path.Join(dir, file)); err == nil {
+			files = append(files, file)
+		}
+	}
+	sort.Strings(files)
+	return strings.Join(files, " ")
+}
+
+func TestBuildContextDockerIgnore(t *testing.T) {
+	const (
+		dockerignore = ".git\n*.log\ndocs\n!docs/README.md\nDockerfile\n.dockerignore\n"
+		expected     = ".dockerignore Dockerfile docs/README.md main.go"
+	)
+
+	// Client side
+	dir := tempBuildContext(t, dockerignore)
+	defer os.RemoveAll(dir)
+	context, err := TarBuildContext(dir, "", archive.Uncompressed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dest, err := ioutil.TempDir("", "docker-test-context")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dest)
+	if err := archive.Untar(context, dest, nil); err != nil {
+		t.Fatal(err)
+	}
+	if files := listFiles(dest); files != expected {
+		t.Fatalf("Expected the context to hold %s, got %s", expected, files)
+	}
+
+	// Server side
+	if err := removeIgnoredFiles(dir, "Dockerfile"); err != nil {
+		t.Fatal(err)
+	}
+	if files := listFiles(dir); files != expected {
+		t.Fatalf("Expected the context to hold %s, got %s", expected, files)
+	}
+}
+
+func TestChecksum(t *testing.T) {
+	dir := tempBuildContext(t, "")
+	defer os.RemoveAll(dir)
+
+	sums := make(map[string]string)
+	for _, file := range []string{"main.go", "docs"} {
+		sum, err := checksum(path.Join(dir, file))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasPrefix(sum, "sha256:") {
+			t.Fatalf("Unexpected checksum for %s: %s", file, sum)
+		}
+		if again, err := checksum(path.Join(dir, file)); err != nil || again != sum {
+			t.Fatalf("Expected the checksum of %s to be stable: %s != %s (%v)", file, sum, again, err)
+		}
+		sums[file] = sum
+	}
+	if sums["main.go"] == sums["docs"] {
+		t.Fatal("Expected a file and a directory to have different checksums")
+	}
+
+	// Touching the files, as a fresh checkout does, doesn't change it
+	later := time.Now().Add(time.Hour)
+	for _, file := range []string{"main.go", "docs", "docs/index.md"} {
+		if err := os.Chtimes(path.Join(dir, file), later, later); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, file := range []string{"main.go", "docs"} {
+		if sum, err := checksum(path.Join(dir, file)); err != nil || sum != sums[file] {
+			t.Fatalf("Expected the checksum of %s not to depend on the modification times: %s != %s (%v)", file, sums[file], sum, err)
+		}
+	}
+
+	// Change the content, but not the size nor the modification time
+	fi, err := os.Stat(path.Join(dir, "docs/index.md"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path.Join(dir, "docs/index.md"), []byte("docs/INDEX.md"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(path.Join(dir, "docs/index.md"), fi.ModTime(), fi.ModTime()); err != nil {
+		t.Fatal(err)
+	}
+	if sum, err := checksum(path.Join(dir, "docs")); err != nil {
+		t.Fatal(err)
+	} else if sum == sums["docs"] {
+		t.Fatal("Expected the checksum to change with the content")
+	}
+}
+
+func TestParseCommand(t *testing.T) {
+	b := &buildFile{line: 7}
+	for args, expected := range map[string][]string{
+		`echo "hello world"`:     {"/bin/sh", "-c", `echo "hello world"`},
+		`["/bin/echo", "hello"]`: {"/bin/echo", "hello"},
+		`[ -f /etc/passwd ]`:     {"/bin/sh", "-c", "[ -f /etc/passwd ]"},
+	} {
+		cmd, err := b.parseCommand("RUN", args)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.Join(cmd, "|") != strings.Join(expected, "|") {
+			t.Fatalf("Expected %q to be parsed as %q, got %q", args, expected, cmd)
+		}
+	}
+	for instruction, args := range map[string]string{
+		"CMD":         `["/bin/echo", 42]`,
+		"RUN":         `[]`,
+		"HEALTHCHECK": `[]`,
+	} {
+		if _, err := b.parseCommand(instruction, args); err == nil {
+			t.Fatalf("Expected %s %s to be rejected", instruction, args)
+		} else if !strings.HasPrefix(err.Error(), "Dockerfile line 7: "+instruction+" ") {
+			t.Fatalf("Expected the error to point to the line, got %s", err)
+		}
+	}
+	// An empty array resets the inherited command
+	for _, instruction := range []string{"CMD", "ENTRYPOINT"} {
+		if cmd, err := b.parseCommand(instruction, `[]`); err != nil || cmd == nil || len(cmd) != 0 {
+			t.Fatalf("Expected %s [] to be an empty command, got %q (%v)", instruction, cmd, err)
+		}
+	}
+}
+
+func TestReplaceEnvMatches(t *testing.T) {
+	env := []string{"BASE=busybox", "TAG=latest"}
+	for value, expected := range map[string]string{
+		"$BASE":          "busybox",
+		"${BASE}:$TAG":   "busybox:latest",
+		"ubuntu":         "ubuntu",
+		"$UNKNOWN":       "$UNKNOWN",
+		"/opt/$BASE/bin": "/opt/busybox/bin",
+	} {
+		replaced, err := replaceEnvMatches(value, env)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if replaced != expected {
+			t.Errorf("Expected %s to be replaced by %s, got %s", value, expected, replaced)
+		}
+	}
+}
+
+func TestBuildInstructions(t *testing.T) {
+	for _, instruction := range parser.Instructions {
+		if _, exists := buildInstructions[instruction]; !exists {
+			t.Errorf("The builder doesn't implement %s", instruction)
+		}
+	}
+	if len(buildInstructions) != len(parser.Instructions) {
+		t.Errorf("Expected the builder to implement %d instructions, got %d", len(parser.Instructions), len(buildInstructions))
+	}
+}
+
+func TestBuildContextDockerfilePath(t *testing.T) {
+	const expected = ".dockerignore Dockerfile docs/index.md main.go"
+
+	dir := tempBuildContext(t, "docs\n*.log\n.git\n")
+	defer os.RemoveAll(dir)
+	context, err := TarBuildContext(dir, "docs/index.md", archive.Uncompressed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dest, err := ioutil.TempDir("", "docker-test-context")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dest)
+	if err := archive.Untar(context, dest, nil); err != nil {
+		t.Fatal(err)
+	}
+	if files := listFiles(dest); files != expected {
+		t.Fatalf("Expected the context to hold %s, got %s", expected, files)
+	}
+
+	if err := removeIgnoredFiles(dir, "/docs/index.md"); err != nil {
+		t.Fatal(err)
+	}
+	if files := listFiles(dir); files != expected {
+		t.Fatalf("Expected the context to hold %s, got %s", expected, files)
+	}
+}
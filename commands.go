@@ -82,6 +82,7 @@ func (cli *DockerCli) CmdHelp(args ...string) error {
 		{"attach", "Attach to a running container"},
 		{"build", "Build a container from a Dockerfile"},
 		{"commit", "Create a new image from a container's changes"},
+		{"container", "Save and load containers"},
 		{"cp", "Copy files/folders from the containers filesystem to the host path"},
 		{"diff", "Inspect changes on a container's filesystem"},
 		{"events", "Get real time events from the server"},
@@ -111,6 +112,7 @@ func (cli *DockerCli) CmdHelp(args ...string) error {
 		{"tag", "Tag an image into a repository"},
 		{"top", "Lookup the running processes of a container"},
 		{"version", "Show the docker version information"},
+		{"volume", "Manage volumes"},
 		{"wait", "Block until a container stops, then print its exit code"},
 	} {
 		help += fmt.Sprintf("    %-10.10s%s\n", command[0], command[1])
@@ -161,12 +163,46 @@ func MkBuildContext(dockerfile string, files [][2]string) (archive.Archive, erro
 	return buf, nil
 }
 
+// TarBuildContext creates an archive of the build context at dir, without
+// the files excluded by its .dockerignore file. The Dockerfile, at the given
+// path of the context, and the .dockerignore file are always included, the
+// daemon needing them.
+func TarBuildContext(dir, dockerfile string, compression archive.Compression) (archive.Archive, error) {
+	includes, excludes, err := utils.WalkDockerIgnore(dir, dockerfile)
+	if err != nil {
+		return nil, err
+	}
+	if len(excludes) == 0 {
+		return archive.Tar(dir, compression)
+	}
+	return archive.TarFilter(dir, &archive.TarOptions{
+		Compression: compression,
+		Includes:    includes,
+		Recursive:   false,
+	})
+}
+
+// lookupEnv returns the value of an environment variable and whether it
+// is set at all, unlike os.Getenv
+func lookupEnv(name string) (string, bool) {
+	for _, env := range os.Environ() {
+		if strings.HasPrefix(env, name+"=") {
+			return env[len(name)+1:], true
+		}
+	}
+	return "", false
+}
+
 func (cli *DockerCli) CmdBuild(args ...string) error {
 	cmd := cli.Subcmd("build", "[OPTIONS] PATH | URL | -", "Build a new container image from the source code at PATH")
 	tag := cmd.String("t", "", "Repository name (and optionally a tag) to be applied to the resulting image in case of success")
 	suppressOutput := cmd.Bool("q", false, "Suppress verbose build output")
 	noCache := cmd.Bool("no-cache", false, "Do not use cache when building the image")
 	rm := cmd.Bool("rm", false, "Remove intermediate containers after a successful build")
+	check := cmd.Bool("check", false, "Only check the syntax of the Dockerfile, without building anything")
+	dockerfileName := cmd.String("f", "", "Path of the Dockerfile in the context (default Dockerfile)")
+	var flBuildArgs utils.ListOpts
+	cmd.Var(&flBuildArgs, "build-arg", "Set a build argument declared by an ARG instruction (KEY=VALUE, or KEY to take the value from the environment)")
 	if err := cmd.Parse(args); err != nil {
 		return nil
 	}
@@ -184,6 +220,9 @@ func (cli *DockerCli) CmdBuild(args ...string) error {
 	if cmd.Arg(0) == "-" {
 		// As a special case, 'docker build -' will build from an empty context with the
 		// contents of stdin as a Dockerfile
+		if *dockerfileName != "" {
+			return fmt.Errorf("-f can't be used when the Dockerfile is read from stdin")
+		}
 		dockerfile, err := ioutil.ReadAll(cli.in)
 		if err != nil {
 			return err
@@ -195,7 +234,15 @@ func (cli *DockerCli) CmdBuild(args ...string) error {
 		if _, err := os.Stat(cmd.Arg(0)); err != nil {
 			return err
 		}
-		context, err = archive.Tar(cmd.Arg(0), archive.Uncompressed)
+		if *dockerfileName != "" {
+			if _, err := os.Stat(path.Join(cmd.Arg(0), *dockerfileName)); err != nil {
+				return fmt.Errorf("Error: the Dockerfile %s must be inside the context %s: %s", *dockerfileName, cmd.Arg(0), err)
+			}
+		}
+		context, err = TarBuildContext(cmd.Arg(0), *dockerfileName, archive.Uncompressed)
+	}
+	if err != nil {
+		return err
 	}
 	var body io.Reader
 	// Setup an upload progress bar
@@ -220,6 +267,22 @@ func (cli *DockerCli) CmdBuild(args ...string) error {
 	if *rm {
 		v.Set("rm", "1")
 	}
+	if *check {
+		v.Set("check", "1")
+	}
+	if *dockerfileName != "" {
+		v.Set("dockerfile", *dockerfileName)
+	}
+	for _, arg := range flBuildArgs {
+		if !strings.Contains(arg, "=") {
+			value, exists := lookupEnv(arg)
+			if !exists {
+				continue
+			}
+			arg = arg + "=" + value
+		}
+		v.Add("buildarg", arg)
+	}
 	req, err := http.NewRequest("POST", fmt.Sprintf("/v%g/build?%s", APIVERSION, v.Encode()), body)
 	if err != nil {
 		return err
@@ -491,6 +554,12 @@ func (cli *DockerCli) CmdInfo(args ...string) error {
 	if !out.SwapLimit {
 		fmt.Fprintf(cli.err, "WARNING: No swap limit support\n")
 	}
+	if !out.CpusetLimit {
+		fmt.Fprintf(cli.err, "WARNING: No cpuset support\n")
+	}
+	if !out.BlkioWeight {
+		fmt.Fprintf(cli.err, "WARNING: No block IO weight support\n")
+	}
 	if !out.IPv4Forwarding {
 		fmt.Fprintf(cli.err, "WARNING: IPv4 forwarding is disabled.\n")
 	}
@@ -498,7 +567,7 @@ func (cli *DockerCli) CmdInfo(args ...string) error {
 }
 
 func (cli *DockerCli) CmdStop(args ...string) error {
-	cmd := cli.Subcmd("stop", "[OPTIONS] CONTAINER [CONTAINER...]", "Stop a running container (Send SIGTERM, and then SIGKILL after grace period)")
+	cmd := cli.Subcmd("stop", "[OPTIONS] CONTAINER [CONTAINER...]", "Stop a running container (Send SIGTERM or the configured stop signal, and then SIGKILL after grace period)")
 	nSeconds := cmd.Int("t", 10, "Number of seconds to wait for the container to stop before killing it.")
 	if err := cmd.Parse(args); err != nil {
 		return nil
@@ -893,10 +962,317 @@ func (cli *DockerCli) CmdRm(args ...string) error {
 
 	var encounteredError error
 	for _, name := range cmd.Args() {
-		_, _, err := cli.call("DELETE", "/containers/"+name+"?"+val.Encode(), nil)
+		body, statusCode, err := cli.call("DELETE", "/containers/"+name+"?"+val.Encode(), nil)
 		if err != nil {
 			fmt.Fprintf(cli.err, "%s\n", err)
 			encounteredError = fmt.Errorf("Error: failed to remove one or more containers")
+			continue
+		}
+		if statusCode == http.StatusOK {
+			var out APIRm
+			if err := json.Unmarshal(body, &out); err != nil {
+				fmt.Fprintf(cli.err, "%s\n", err)
+			}
+			for _, warning := range out.Warnings {
+				fmt.Fprintf(cli.err, "WARNING: %s\n", warning)
+			}
+		}
+		fmt.Fprintf(cli.out, "%s\n", name)
+	}
+	return encounteredError
+}
+
+// 'docker volume COMMAND' manages the volumes
+func (cli *DockerCli) CmdVolume(args ...string) error {
+	description := "Manage volumes\n\nCommands:\n"
+	for _, command := range [][]string{
+		{"create", "Create a volume"},
+		{"export", "Stream a tar archive of the volumes of a container to STDOUT"},
+		{"import", "Restore the volumes of a container from a tar archive on STDIN"},
+		{"inspect", "Return low-level information on a volume"},
+		{"ls", "List volumes"},
+		{"prune", "Remove unused volumes"},
+		{"rm", "Remove one or more volumes"},
+	} {
+		description += fmt.Sprintf("    %-10.10s%s\n", command[0], command[1])
+	}
+	cmd := cli.Subcmd("volume", "COMMAND [arg...]", description)
+	if err := cmd.Parse(args); err != nil {
+		return nil
+	}
+	if cmd.NArg() < 1 {
+		cmd.Usage()
+		return nil
+	}
+	switch cmd.Arg(0) {
+	case "create":
+		return cli.volumeCreate(cmd.Args()[1:]...)
+	case "export":
+		return cli.volumeExport(cmd.Args()[1:]...)
+	case "import":
+		return cli.volumeImport(cmd.Args()[1:]...)
+	case "inspect":
+		return cli.volumeInspect(cmd.Args()[1:]...)
+	case "ls":
+		return cli.volumeList(cmd.Args()[1:]...)
+	case "prune":
+		return cli.volumePrune(cmd.Args()[1:]...)
+	case "rm":
+		return cli.volumeRm(cmd.Args()[1:]...)
+	}
+	fmt.Fprintf(cli.err, "Error: Unknown volume command: %s\n", cmd.Arg(0))
+	cmd.Usage()
+	return nil
+}
+
+func (cli *DockerCli) volumeCreate(args ...string) error {
+	cmd := cli.Subcmd("volume create", "[OPTIONS] [NAME]", "Create a volume, anonymous if no name is given")
+	driver := cmd.String("d", "local", "Volume driver storing the volume")
+	if err := cmd.Parse(args); err != nil {
+		return nil
+	}
+	if cmd.NArg() > 1 {
+		cmd.Usage()
+		return nil
+	}
+	val := url.Values{}
+	val.Set("name", cmd.Arg(0))
+	val.Set("driver", *driver)
+	body, _, err := cli.call("POST", "/volumes/create?"+val.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	var volume APIVolume
+	if err := json.Unmarshal(body, &volume); err != nil {
+		return err
+	}
+	if volume.Name != "" {
+		fmt.Fprintf(cli.out, "%s\n", volume.Name)
+	} else {
+		fmt.Fprintf(cli.out, "%s\n", volume.ID)
+	}
+	return nil
+}
+
+func (cli *DockerCli) volumeExport(args ...string) error {
+	cmd := cli.Subcmd("volume export", "CONTAINER [PATH...]", "Stream a tar archive of the volumes of a container mounted at PATH, or of all of them, to STDOUT")
+	if err := cmd.Parse(args); err != nil {
+		return nil
+	}
+	if cmd.NArg() < 1 {
+		cmd.Usage()
+		return nil
+	}
+	v := url.Values{}
+	for _, volPath := range cmd.Args()[1:] {
+		v.Add("path", volPath)
+	}
+	return cli.stream("GET", "/containers/"+cmd.Arg(0)+"/volumes?"+v.Encode(), nil, cli.out, nil)
+}
+
+func (cli *DockerCli) volumeImport(args ...string) error {
+	cmd := cli.Subcmd("volume import", "[OPTIONS] CONTAINER", "Restore the volumes of a stopped container from a tar archive on STDIN, made by 'docker volume export'")
+	keepDrivers := cmd.Bool("keep-drivers", false, "Create the volumes with the drivers recorded in the archive, instead of the local driver")
+	if err := cmd.Parse(args); err != nil {
+		return nil
+	}
+	if cmd.NArg() != 1 {
+		cmd.Usage()
+		return nil
+	}
+	v := url.Values{}
+	if *keepDrivers {
+		v.Set("keepdrivers", "1")
+	}
+	return cli.stream("POST", "/containers/"+cmd.Arg(0)+"/volumes?"+v.Encode(), cli.in, cli.out, nil)
+}
+
+func (cli *DockerCli) volumeInspect(args ...string) error {
+	cmd := cli.Subcmd("volume inspect", "VOLUME [VOLUME...]", "Return low-level information on a volume")
+	if err := cmd.Parse(args); err != nil {
+		return nil
+	}
+	if cmd.NArg() < 1 {
+		cmd.Usage()
+		return nil
+	}
+
+	indented := new(bytes.Buffer)
+	status := 0
+
+	for _, name := range cmd.Args() {
+		obj, _, err := cli.call("GET", "/volumes/"+name+"/json", nil)
+		if err != nil {
+			fmt.Fprintf(cli.err, "%s\n", err)
+			status = 1
+			continue
+		}
+		if err = json.Indent(indented, obj, "", "    "); err != nil {
+			fmt.Fprintf(cli.err, "%s\n", err)
+			status = 1
+			continue
+		}
+		indented.WriteString(",")
+	}
+
+	if indented.Len() > 0 {
+		// Remove trailing ','
+		indented.Truncate(indented.Len() - 1)
+	}
+	fmt.Fprintf(cli.out, "[")
+	if _, err := io.Copy(cli.out, indented); err != nil {
+		return err
+	}
+	fmt.Fprintf(cli.out, "]")
+	if status != 0 {
+		return &utils.StatusError{Status: status}
+	}
+	return nil
+}
+
+func (cli *DockerCli) volumeList(args ...string) error {
+	cmd := cli.Subcmd("volume ls", "[OPTIONS]", "List volumes")
+	quiet := cmd.Bool("q", false, "Only display volume names (or IDs of anonymous volumes)")
+	noTrunc := cmd.Bool("notrunc", false, "Don't truncate output")
+	if err := cmd.Parse(args); err != nil {
+		return nil
+	}
+	if cmd.NArg() > 0 {
+		cmd.Usage()
+		return nil
+	}
+
+	body, _, err := cli.call("GET", "/volumes/json", nil)
+	if err != nil {
+		return err
+	}
+	var outs []APIVolume
+	if err := json.Unmarshal(body, &outs); err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(cli.out, 20, 1, 3, ' ', 0)
+	if !*quiet {
+		fmt.Fprintln(w, "VOLUME NAME\tVOLUME ID\tDRIVER\tCREATED\tCONTAINERS")
+	}
+	for _, out := range outs {
+		id := out.ID
+		containers := out.Containers
+		if !*noTrunc {
+			id = utils.TruncateID(id)
+			for i, c := range containers {
+				containers[i] = utils.TruncateID(c)
+			}
+		}
+		if *quiet {
+			if out.Name != "" {
+				fmt.Fprintln(w, out.Name)
+			} else {
+				fmt.Fprintln(w, id)
+			}
+			continue
+		}
+		name := out.Name
+		if name == "" {
+			name = "<none>"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s ago\t%s\n", name, id, out.Driver, utils.HumanDuration(time.Now().UTC().Sub(time.Unix(out.Created, 0))), strings.Join(containers, ","))
+	}
+	w.Flush()
+	return nil
+}
+
+func (cli *DockerCli) volumePrune(args ...string) error {
+	cmd := cli.Subcmd("volume prune", "[OPTIONS]", "Remove the volumes not used by any container")
+	all := cmd.Bool("a", false, "Also remove unused named volumes")
+	force := cmd.Bool("f", false, "Do not prompt for confirmation")
+	if err := cmd.Parse(args); err != nil {
+		return nil
+	}
+	if cmd.NArg() > 0 {
+		cmd.Usage()
+		return nil
+	}
+
+	v := url.Values{}
+	if *all {
+		v.Set("all", "1")
+	}
+	v.Set("dryrun", "1")
+	body, _, err := cli.call("POST", "/volumes/prune?"+v.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	var candidates APIVolumesPrune
+	if err := json.Unmarshal(body, &candidates); err != nil {
+		return err
+	}
+	if len(candidates.Volumes) == 0 {
+		fmt.Fprintf(cli.out, "No unused volumes\n")
+		return nil
+	}
+
+	w := tabwriter.NewWriter(cli.out, 20, 1, 3, ' ', 0)
+	fmt.Fprintln(w, "VOLUME NAME\tVOLUME ID\tDRIVER\tSIZE")
+	for _, out := range candidates.Volumes {
+		name := out.Name
+		if name == "" {
+			name = "<none>"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", name, utils.TruncateID(out.ID), out.Driver, utils.HumanSize(out.Size))
+	}
+	w.Flush()
+
+	if !*force {
+		fmt.Fprintf(cli.out, "This will remove %d volume(s), reclaiming %s. Are you sure? [y/N] ", len(candidates.Volumes), utils.HumanSize(candidates.SpaceReclaimed))
+		line, _, err := bufio.NewReader(cli.in).ReadLine()
+		if err != nil {
+			return err
+		}
+		if answer := strings.ToLower(strings.TrimSpace(string(line))); answer != "y" && answer != "yes" {
+			return nil
+		}
+	}
+
+	// Only remove the volumes listed above, in case some became unused meanwhile
+	v.Del("dryrun")
+	for _, out := range candidates.Volumes {
+		v.Add("id", out.ID)
+	}
+	body, _, err = cli.call("POST", "/volumes/prune?"+v.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	var pruned APIVolumesPrune
+	if err := json.Unmarshal(body, &pruned); err != nil {
+		return err
+	}
+	for _, out := range pruned.Volumes {
+		if out.Name != "" {
+			fmt.Fprintf(cli.out, "%s\n", out.Name)
+		} else {
+			fmt.Fprintf(cli.out, "%s\n", out.ID)
+		}
+	}
+	fmt.Fprintf(cli.out, "Total reclaimed space: %s\n", utils.HumanSize(pruned.SpaceReclaimed))
+	return nil
+}
+
+func (cli *DockerCli) volumeRm(args ...string) error {
+	cmd := cli.Subcmd("volume rm", "VOLUME [VOLUME...]", "Remove one or more volumes, which must not be used by any container")
+	if err := cmd.Parse(args); err != nil {
+		return nil
+	}
+	if cmd.NArg() < 1 {
+		cmd.Usage()
+		return nil
+	}
+
+	var encounteredError error
+	for _, name := range cmd.Args() {
+		if _, _, err := cli.call("DELETE", "/volumes/"+name, nil); err != nil {
+			fmt.Fprintf(cli.err, "%s\n", err)
+			encounteredError = fmt.Errorf("Error: failed to remove one or more volumes")
 		} else {
 			fmt.Fprintf(cli.out, "%s\n", name)
 		}
@@ -906,7 +1282,8 @@ func (cli *DockerCli) CmdRm(args ...string) error {
 
 // 'docker kill NAME' kills a running container
 func (cli *DockerCli) CmdKill(args ...string) error {
-	cmd := cli.Subcmd("kill", "CONTAINER [CONTAINER...]", "Kill a running container (send SIGKILL)")
+	cmd := cli.Subcmd("kill", "[OPTIONS] CONTAINER [CONTAINER...]", "Kill a running container (send SIGKILL, or the specified signal)")
+	signal := cmd.String("s", "", "Signal to send to the container, by name (e.g. SIGQUIT) or number")
 	if err := cmd.Parse(args); err != nil {
 		return nil
 	}
@@ -915,9 +1292,17 @@ func (cli *DockerCli) CmdKill(args ...string) error {
 		return nil
 	}
 
+	v := url.Values{}
+	if *signal != "" {
+		if _, err := utils.ParseSignal(*signal); err != nil {
+			return err
+		}
+		v.Set("signal", *signal)
+	}
+
 	var encounteredError error
-	for _, name := range args {
-		if _, _, err := cli.call("POST", "/containers/"+name+"/kill", nil); err != nil {
+	for _, name := range cmd.Args() {
+		if _, _, err := cli.call("POST", "/containers/"+name+"/kill?"+v.Encode(), nil); err != nil {
 			fmt.Fprintf(cli.err, "%s\n", err)
 			encounteredError = fmt.Errorf("Error: failed to kill one or more containers")
 		} else {
@@ -1738,11 +2123,18 @@ func parseRun(cmd *flag.FlagSet, args []string, capabilities *Capabilities) (*Co
 		flDns         utils.ListOpts
 		flVolumesFrom utils.ListOpts
 		flLxcOpts     utils.ListOpts
+		flCapAdd      utils.ListOpts
+		flCapDrop     utils.ListOpts
+		flDevices     utils.ListOpts
+		flGroupAdd    utils.ListOpts
+		flUlimits     utils.ListOpts
+		flTmpfs       utils.ListOpts
 
 		flAutoRemove      = cmd.Bool("rm", false, "Automatically remove the container when it exits (incompatible with -d)")
 		flDetach          = cmd.Bool("d", false, "Detached mode: Run container in the background, print new container id")
 		flNetwork         = cmd.Bool("n", true, "Enable networking for this container")
 		flPrivileged      = cmd.Bool("privileged", false, "Give extended privileges to this container")
+		flReadonlyRootfs  = cmd.Bool("read-only", false, "Mount the container's root filesystem as read only")
 		flPublishAll      = cmd.Bool("P", false, "Publish all exposed ports to the host interfaces")
 		flStdin           = cmd.Bool("i", false, "Keep stdin open even if not attached")
 		flTty             = cmd.Bool("t", false, "Allocate a pseudo-tty")
@@ -1750,9 +2142,19 @@ func parseRun(cmd *flag.FlagSet, args []string, capabilities *Capabilities) (*Co
 		flEntrypoint      = cmd.String("entrypoint", "", "Overwrite the default entrypoint of the image")
 		flHostname        = cmd.String("h", "", "Container host name")
 		flMemoryString    = cmd.String("m", "", "Memory limit (format: <number><optional unit>, where unit = b, k, m or g)")
-		flUser            = cmd.String("u", "", "Username or UID")
+		flUser            = cmd.String("u", "", "Username or UID, optionally followed by a group name or GID (format: user[:group])")
 		flWorkingDir      = cmd.String("w", "", "Working directory inside the container")
 		flCpuShares       = cmd.Int64("c", 0, "CPU shares (relative weight)")
+		flCpusetCpus      = cmd.String("cpuset", "", "CPUs in which to allow execution (e.g. 0-3, 0,1)")
+		flCpusetMems      = cmd.String("cpuset-mems", "", "Memory nodes in which to allow execution (e.g. 0-3, 0,1)")
+		flBlkioWeight     = cmd.Int64("blkio-weight", 0, "Block IO weight (relative weight, between 10 and 1000)")
+		flHealthCmd       = cmd.String("health-cmd", "", "Command to run inside the container to check its health")
+		flHealthInterval  = cmd.Duration("health-interval", 0, "Time between two health checks (e.g. 30s)")
+		flHealthTimeout   = cmd.Duration("health-timeout", 0, "Maximum time a health check is allowed to run (e.g. 30s)")
+		flHealthRetries   = cmd.Int("health-retries", 0, "Consecutive failures needed to report the container as unhealthy")
+		flNoHealthcheck   = cmd.Bool("no-healthcheck", false, "Disable any health check inherited from the image")
+		flStopSignal      = cmd.String("stop-signal", "", "Signal sent to stop the container (default SIGTERM)")
+		flInit            = cmd.Bool("init", false, "Run a minimal init inside the container that forwards signals and reaps zombies")
 
 		// For documentation purpose
 		_ = cmd.Bool("sig-proxy", true, "Proxify all received signal to the process (even in non-tty mode)")
@@ -1760,7 +2162,7 @@ func parseRun(cmd *flag.FlagSet, args []string, capabilities *Capabilities) (*Co
 	)
 
 	cmd.Var(flAttach, "a", "Attach to stdin, stdout or stderr.")
-	cmd.Var(flVolumes, "v", "Bind mount a volume (e.g. from the host: -v /host:/container, from docker: -v /container)")
+	cmd.Var(flVolumes, "v", "Bind mount a volume (e.g. from the host: -v /host:/container, from a named volume: -v name:/container, from docker: -v /container)")
 	cmd.Var(&flLinks, "link", "Add link to another container (name:alias)")
 
 	cmd.Var(&flPublish, "p", fmt.Sprintf("Publish a container's port to the host (format: %s) (use 'docker port' to see the actual mapping)", PortSpecTemplateFormat))
@@ -1769,6 +2171,12 @@ func parseRun(cmd *flag.FlagSet, args []string, capabilities *Capabilities) (*Co
 	cmd.Var(&flDns, "dns", "Set custom dns servers")
 	cmd.Var(&flVolumesFrom, "volumes-from", "Mount volumes from the specified container(s)")
 	cmd.Var(&flLxcOpts, "lxc-conf", "Add custom lxc options -lxc-conf=\"lxc.cgroup.cpuset.cpus = 0,1\"")
+	cmd.Var(&flCapAdd, "cap-add", "Add a linux capability to the container (e.g. NET_ADMIN, or ALL)")
+	cmd.Var(&flCapDrop, "cap-drop", "Drop a linux capability from the container (e.g. CHOWN, or ALL)")
+	cmd.Var(&flGroupAdd, "group-add", "Add a supplementary group to the user (name or GID)")
+	cmd.Var(&flTmpfs, "tmpfs", "Mount a tmpfs directory (format: path[:options], where options = size=<size>,mode=<octal mode>, e.g. -tmpfs=/run:size=64m,mode=755)")
+	cmd.Var(&flUlimits, "ulimit", "Set a resource limit (format: name=soft[:hard], e.g. -ulimit=nofile=1024:4096)")
+	cmd.Var(&flDevices, "device", "Add a host device to the container (format: host[:container[:permissions]], e.g. -device=/dev/fuse:/dev/fuse:rwm)")
 
 	if err := cmd.Parse(args); err != nil {
 		return nil, nil, cmd, err
@@ -1778,6 +2186,14 @@ func parseRun(cmd *flag.FlagSet, args []string, capabilities *Capabilities) (*Co
 	if capabilities != nil && *flMemoryString != "" && !capabilities.MemoryLimit {
 		*flMemoryString = ""
 	}
+	// Check if the kernel supports cpuset and blkio cgroups.
+	if capabilities != nil && !capabilities.CpusetLimit {
+		*flCpusetCpus = ""
+		*flCpusetMems = ""
+	}
+	if capabilities != nil && !capabilities.BlkioWeight {
+		*flBlkioWeight = 0
+	}
 
 	// Validate input params
 	if *flDetach && len(flAttach) > 0 {
@@ -1789,6 +2205,45 @@ func parseRun(cmd *flag.FlagSet, args []string, capabilities *Capabilities) (*Co
 	if *flDetach && *flAutoRemove {
 		return nil, nil, cmd, ErrConflictDetachAutoRemove
 	}
+	if *flCpusetCpus != "" {
+		if err := validateCpuset(*flCpusetCpus); err != nil {
+			return nil, nil, cmd, err
+		}
+	}
+	if *flCpusetMems != "" {
+		if err := validateCpuset(*flCpusetMems); err != nil {
+			return nil, nil, cmd, err
+		}
+	}
+	if err := validateBlkioWeight(*flBlkioWeight); err != nil {
+		return nil, nil, cmd, err
+	}
+	if *flStopSignal != "" {
+		if _, err := utils.ParseSignal(*flStopSignal); err != nil {
+			return nil, nil, cmd, err
+		}
+	}
+	for _, group := range flGroupAdd {
+		if group == "" || strings.Contains(group, ",") {
+			return nil, nil, cmd, fmt.Errorf("Invalid group: %s", group)
+		}
+	}
+	tmpfs := make(map[string]string)
+	for _, rawTmpfs := range flTmpfs {
+		dst, options, err := parseTmpfs(rawTmpfs)
+		if err != nil {
+			return nil, nil, cmd, err
+		}
+		tmpfs[dst] = options
+	}
+	var ulimits []*utils.Ulimit
+	for _, rawUlimit := range flUlimits {
+		ulimit, err := utils.ParseUlimit(rawUlimit)
+		if err != nil {
+			return nil, nil, cmd, err
+		}
+		ulimits = append(ulimits, ulimit)
+	}
 
 	// If neither -d or -a are set, attach to everything by default
 	if len(flAttach) == 0 && !*flDetach {
@@ -1857,6 +2312,42 @@ func parseRun(cmd *flag.FlagSet, args []string, capabilities *Capabilities) (*Co
 		return nil, nil, cmd, err
 	}
 
+	capAdd, err := parseCapabilities(flCapAdd)
+	if err != nil {
+		return nil, nil, cmd, err
+	}
+	capDrop, err := parseCapabilities(flCapDrop)
+	if err != nil {
+		return nil, nil, cmd, err
+	}
+
+	var devices []DeviceMapping
+	for _, d := range flDevices {
+		device, err := parseDevice(d)
+		if err != nil {
+			return nil, nil, cmd, err
+		}
+		devices = append(devices, device)
+	}
+
+	var healthConfig *HealthConfig
+	if *flHealthCmd == "" && (*flHealthInterval != 0 || *flHealthTimeout != 0 || *flHealthRetries != 0) {
+		return nil, nil, cmd, fmt.Errorf("-health-interval, -health-timeout and -health-retries require -health-cmd")
+	}
+	if *flNoHealthcheck {
+		if *flHealthCmd != "" {
+			return nil, nil, cmd, fmt.Errorf("Conflicting options: -no-healthcheck and -health-cmd")
+		}
+		healthConfig = &HealthConfig{Test: []string{"NONE"}}
+	} else if *flHealthCmd != "" {
+		healthConfig = &HealthConfig{
+			Test:     []string{"/bin/sh", "-c", *flHealthCmd},
+			Interval: *flHealthInterval,
+			Timeout:  *flHealthTimeout,
+			Retries:  *flHealthRetries,
+		}
+	}
+
 	var (
 		domainname string
 		hostname   = *flHostname
@@ -1894,6 +2385,9 @@ func parseRun(cmd *flag.FlagSet, args []string, capabilities *Capabilities) (*Co
 		OpenStdin:       *flStdin,
 		Memory:          flMemory,
 		CpuShares:       *flCpuShares,
+		CpusetCpus:      *flCpusetCpus,
+		CpusetMems:      *flCpusetMems,
+		BlkioWeight:     *flBlkioWeight,
 		AttachStdin:     flAttach["stdin"],
 		AttachStdout:    flAttach["stdout"],
 		AttachStderr:    flAttach["stderr"],
@@ -1905,6 +2399,9 @@ func parseRun(cmd *flag.FlagSet, args []string, capabilities *Capabilities) (*Co
 		VolumesFrom:     strings.Join(flVolumesFrom, ","),
 		Entrypoint:      entrypoint,
 		WorkingDir:      *flWorkingDir,
+		Healthcheck:     healthConfig,
+		StopSignal:      *flStopSignal,
+		Init:            *flInit,
 	}
 
 	hostConfig := &HostConfig{
@@ -1915,6 +2412,13 @@ func parseRun(cmd *flag.FlagSet, args []string, capabilities *Capabilities) (*Co
 		PortBindings:    portBindings,
 		Links:           flLinks,
 		PublishAllPorts: *flPublishAll,
+		CapAdd:          capAdd,
+		CapDrop:         capDrop,
+		Devices:         devices,
+		GroupAdd:        flGroupAdd,
+		Ulimits:         ulimits,
+		ReadonlyRootfs:  *flReadonlyRootfs,
+		Tmpfs:           tmpfs,
 	}
 
 	if capabilities != nil && flMemory > 0 && !capabilities.SwapLimit {
@@ -2159,6 +2663,66 @@ func (cli *DockerCli) CmdRun(args ...string) error {
 	return nil
 }
 
+func (cli *DockerCli) CmdContainer(args ...string) error {
+	description := "Save and load containers\n\nCommands:\n"
+	for _, command := range [][]string{
+		{"load", "Create a stopped container from a tar archive on STDIN"},
+		{"save", "Save a container with its config and volumes to a tar archive on STDOUT"},
+	} {
+		description += fmt.Sprintf("    %-10.10s%s\n", command[0], command[1])
+	}
+	cmd := cli.Subcmd("container", "COMMAND [arg...]", description)
+	if err := cmd.Parse(args); err != nil {
+		return nil
+	}
+	if cmd.NArg() < 1 {
+		cmd.Usage()
+		return nil
+	}
+	switch cmd.Arg(0) {
+	case "load":
+		return cli.containerLoad(cmd.Args()[1:]...)
+	case "save":
+		return cli.containerSave(cmd.Args()[1:]...)
+	}
+	fmt.Fprintf(cli.err, "Error: Unknown container command: %s\n", cmd.Arg(0))
+	cmd.Usage()
+	return nil
+}
+
+func (cli *DockerCli) containerSave(args ...string) error {
+	cmd := cli.Subcmd("container save", "CONTAINER", "Save a container with its config, filesystem changes and volumes to a tar archive on STDOUT")
+	if err := cmd.Parse(args); err != nil {
+		return nil
+	}
+	if cmd.NArg() != 1 {
+		cmd.Usage()
+		return nil
+	}
+	return cli.stream("GET", "/containers/"+cmd.Arg(0)+"/get", nil, cli.out, nil)
+}
+
+func (cli *DockerCli) containerLoad(args ...string) error {
+	cmd := cli.Subcmd("container load", "[OPTIONS]", "Create a stopped container from a tar archive on STDIN, made by 'docker container save'")
+	name := cmd.String("name", "", "Name of the container, instead of the name of the saved one")
+	keepDrivers := cmd.Bool("keep-drivers", false, "Create the volumes with the drivers recorded in the archive, instead of the local driver")
+	if err := cmd.Parse(args); err != nil {
+		return nil
+	}
+	if cmd.NArg() != 0 {
+		cmd.Usage()
+		return nil
+	}
+	v := url.Values{}
+	if *name != "" {
+		v.Set("name", *name)
+	}
+	if *keepDrivers {
+		v.Set("keepdrivers", "1")
+	}
+	return cli.stream("POST", "/containers/load?"+v.Encode(), cli.in, cli.out, nil)
+}
+
 func (cli *DockerCli) CmdCp(args ...string) error {
 	cmd := cli.Subcmd("cp", "CONTAINER:PATH HOSTPATH", "Copy files/folders from the PATH to the HOSTPATH")
 	if err := cmd.Parse(args); err != nil {
@@ -2,6 +2,7 @@ package docker
 
 import (
 	"github.com/dotcloud/docker/engine"
+	"github.com/dotcloud/docker/utils"
 	"net"
 )
 
@@ -17,6 +18,7 @@ type DaemonConfig struct {
 	DefaultIp                   net.IP
 	InterContainerCommunication bool
 	GraphDriver                 string
+	DefaultUlimits              []*utils.Ulimit
 }
 
 // ConfigFromJob creates and returns a new DaemonConfig object
@@ -39,5 +41,14 @@ func ConfigFromJob(job *engine.Job) *DaemonConfig {
 	config.DefaultIp = net.ParseIP(job.Getenv("DefaultIp"))
 	config.InterContainerCommunication = job.GetenvBool("InterContainerCommunication")
 	config.GraphDriver = job.Getenv("GraphDriver")
+	for _, rawUlimit := range job.GetenvList("DefaultUlimits") {
+		ulimit, err := utils.ParseUlimit(rawUlimit)
+		if err != nil {
+			// The daemon flags are validated before the job is created
+			utils.Errorf("Ignoring default ulimit: %s", err)
+			continue
+		}
+		config.DefaultUlimits = append(config.DefaultUlimits, ulimit)
+	}
 	return &config
 }
@@ -61,6 +61,32 @@ func TestCompareConfig(t *testing.T) {
 	}
 }
 
+func TestConfigDigest(t *testing.T) {
+	config1 := Config{
+		Cmd:          []string{"/bin/sh", "-c", "make"},
+		Env:          []string{"VAR1=1"},
+		ExposedPorts: map[Port]struct{}{"80/tcp": {}, "443/tcp": {}},
+		Volumes:      map[string]struct{}{"/data": {}, "/logs": {}},
+	}
+	config2 := Config{
+		Cmd:          []string{"/bin/sh", "-c", "make"},
+		Env:          []string{"VAR1=1"},
+		Dns:          []string{},
+		ExposedPorts: map[Port]struct{}{"443/tcp": {}, "80/tcp": {}},
+		Volumes:      map[string]struct{}{"/logs": {}, "/data": {}},
+		Hostname:     "ignored",
+	}
+	config3 := config1
+	config3.Cmd = []string{"/bin/sh", "-c", "make install"}
+
+	if !CompareConfig(&config1, &config2) || configDigest(&config1) != configDigest(&config2) {
+		t.Fatalf("Configs which compare equal should have the same digest")
+	}
+	if configDigest(&config1) == configDigest(&config3) {
+		t.Fatalf("Configs with different commands should have different digests")
+	}
+}
+
 func TestMergeConfig(t *testing.T) {
 	volumesImage := make(map[string]struct{})
 	volumesImage["/test1"] = struct{}{}
@@ -17,6 +17,7 @@ import (
 	"os"
 	"os/exec"
 	"path"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
@@ -63,10 +64,15 @@ type Container struct {
 	Volumes  map[string]string
 	// Store rw/ro in a separate structure to preserve reverse-compatibility on-disk.
 	// Easier than migrating older container configs :)
-	VolumesRW  map[string]bool
+	VolumesRW map[string]bool
+	// The ID of the volume mounted at each path, bind mounts from the
+	// host have none. Volume drivers can mount a volume at a different
+	// host path each time, so Volumes doesn't identify it.
+	VolumeIDs  map[string]string `json:",omitempty"`
 	hostConfig *HostConfig
 
 	activeLinks map[string]*Link
+	devices     []*Device
 }
 
 // Note: the Config structure should hold only portable information about the container.
@@ -76,9 +82,12 @@ type Config struct {
 	Hostname        string
 	Domainname      string
 	User            string
-	Memory          int64 // Memory limit (in bytes)
-	MemorySwap      int64 // Total memory usage (memory + swap); set `-1' to disable swap
-	CpuShares       int64 // CPU shares (relative weight vs. other containers)
+	Memory          int64  // Memory limit (in bytes)
+	MemorySwap      int64  // Total memory usage (memory + swap); set `-1' to disable swap
+	CpuShares       int64  // CPU shares (relative weight vs. other containers)
+	CpusetCpus      string // CPUs in which to allow execution (eg. 0-3 or 0,1)
+	CpusetMems      string // Memory nodes in which to allow execution (eg. 0-3 or 0,1)
+	BlkioWeight     int64  // Block IO weight (relative weight vs. other containers, 10 to 1000)
 	AttachStdin     bool
 	AttachStdout    bool
 	AttachStderr    bool
@@ -96,6 +105,10 @@ type Config struct {
 	WorkingDir      string
 	Entrypoint      []string
 	NetworkDisabled bool
+	Healthcheck     *HealthConfig `json:",omitempty"`
+	StopSignal      string        `json:",omitempty"` // Signal sent to stop the container (eg. SIGTERM or 15)
+	Init            bool          `json:",omitempty"` // Run a minimal init as PID 1 that forwards signals and reaps zombies
+	OnBuild         []string      `json:",omitempty"` // Instructions run by the builds starting FROM the image
 }
 
 type HostConfig struct {
@@ -106,12 +119,26 @@ type HostConfig struct {
 	PortBindings    map[Port][]PortBinding
 	Links           []string
 	PublishAllPorts bool
+	CapAdd          []string
+	CapDrop         []string
+	Devices         []DeviceMapping
+	GroupAdd        []string
+	Ulimits         []*utils.Ulimit
+	ReadonlyRootfs  bool
+	Tmpfs           map[string]string // Path in the container => tmpfs mount options
 }
 
 type BindMap struct {
 	SrcPath string
 	DstPath string
 	Mode    string
+	volume  *Volume // Named volume mounted instead of a host path
+}
+
+type DeviceMapping struct {
+	PathOnHost        string
+	PathInContainer   string
+	CgroupPermissions string
 }
 
 var (
@@ -532,6 +559,16 @@ func (container *Container) Start() (err error) {
 		container.Config.MemorySwap = -1
 	}
 
+	if (container.Config.CpusetCpus != "" || container.Config.CpusetMems != "") && !container.runtime.capabilities.CpusetLimit {
+		log.Printf("WARNING: Your kernel does not support cpuset capabilities. Limitation discarded.\n")
+		container.Config.CpusetCpus = ""
+		container.Config.CpusetMems = ""
+	}
+	if container.Config.BlkioWeight > 0 && !container.runtime.capabilities.BlkioWeight {
+		log.Printf("WARNING: Your kernel does not support block IO weight capabilities. Limitation discarded.\n")
+		container.Config.BlkioWeight = 0
+	}
+
 	if container.runtime.capabilities.IPv4ForwardingDisabled {
 		log.Printf("WARNING: IPv4 forwarding is disabled. Networking will not work")
 	}
@@ -569,6 +606,19 @@ func (container *Container) Start() (err error) {
 			DstPath: dst,
 			Mode:    mode,
 		}
+		// A source which is not a path is the name of a volume,
+		// created the first time it is used and mounted along with the
+		// other volumes
+		if !path.IsAbs(src) {
+			// Exact names only: a prefix of the ID of another volume isn't it
+			volume, err := container.runtime.volumeStore.GetExact(src)
+			if err != nil {
+				if volume, err = container.runtime.volumeStore.Create(src, ""); err != nil {
+					return err
+				}
+			}
+			bindMap.volume = volume
+		}
 		binds[path.Clean(dst)] = bindMap
 	}
 
@@ -576,6 +626,9 @@ func (container *Container) Start() (err error) {
 		container.Volumes = make(map[string]string)
 		container.VolumesRW = make(map[string]bool)
 	}
+	if container.VolumeIDs == nil {
+		container.VolumeIDs = make(map[string]string)
+	}
 
 	// Apply volumes from another container if requested
 	if container.Config.VolumesFrom != "" {
@@ -607,6 +660,9 @@ func (container *Container) Start() (err error) {
 					return err
 				}
 				container.Volumes[volPath] = id
+				if volumeID, exists := c.VolumeIDs[volPath]; exists {
+					container.VolumeIDs[volPath] = volumeID
+				}
 				if isRW, exists := c.VolumesRW[volPath]; exists {
 					container.VolumesRW[volPath] = isRW && mountRW
 				}
@@ -615,7 +671,18 @@ func (container *Container) Start() (err error) {
 		}
 	}
 
-	volumesDriver := container.runtime.volumes.driver
+	// Mount the volumes the container already has, which a volume
+	// driver may mount at a different path than the last time
+	for volPath := range container.Volumes {
+		if volume := container.volume(volPath); volume != nil && !volume.isLocal() {
+			mountpoint, err := container.runtime.volumeStore.Mount(volume)
+			if err != nil {
+				return err
+			}
+			container.Volumes[volPath] = mountpoint
+		}
+	}
+
 	// Create the requested volumes if they don't exist
 	for volPath := range container.Config.Volumes {
 		volPath = path.Clean(volPath)
@@ -624,31 +691,32 @@ func (container *Container) Start() (err error) {
 			continue
 		}
 		var srcPath string
-		var isBindMount bool
+		var volume *Volume
 		srcRW := false
 		// If an external bind is defined for this volume, use that as a source
 		if bindMap, exists := binds[volPath]; exists {
-			isBindMount = true
+			// Named volumes get populated like anonymous ones
+			volume = bindMap.volume
 			srcPath = bindMap.SrcPath
 			if strings.ToLower(bindMap.Mode) == "rw" {
 				srcRW = true
 			}
 			// Otherwise create an directory in $ROOT/volumes/ and use that
 		} else {
-
-			// Do not pass a container as the parameter for the volume creation.
-			// The graph driver using the container's information ( Image ) to
-			// create the parent.
-			c, err := container.runtime.volumes.Create(nil, nil, "", "", nil)
-			if err != nil {
+			var err error
+			if volume, err = container.runtime.volumeStore.Create("", ""); err != nil {
 				return err
 			}
-			srcPath, err = volumesDriver.Get(c.ID)
-			if err != nil {
-				return fmt.Errorf("Driver %s failed to get volume rootfs %s: %s", volumesDriver, c.ID, err)
-			}
 			srcRW = true // RW by default
 		}
+		isBindMount := volume == nil
+		if !isBindMount {
+			var err error
+			if srcPath, err = container.runtime.volumeStore.Mount(volume); err != nil {
+				return err
+			}
+			container.VolumeIDs[volPath] = volume.ID
+		}
 		container.Volumes[volPath] = srcPath
 		container.VolumesRW[volPath] = srcRW
 		// Create the mountpoint
@@ -694,6 +762,19 @@ func (container *Container) Start() (err error) {
 		}
 	}
 
+	// Create the requested device nodes
+	container.devices = nil
+	for _, mapping := range container.hostConfig.Devices {
+		device, err := getDevice(mapping)
+		if err != nil {
+			return err
+		}
+		if err := createDeviceNode(container.RootfsPath(), device); err != nil {
+			return err
+		}
+		container.devices = append(container.devices, device)
+	}
+
 	if err := container.generateLXCConfig(); err != nil {
 		return err
 	}
@@ -720,6 +801,29 @@ func (container *Container) Start() (err error) {
 	if container.Config.User != "" {
 		params = append(params, "-u", container.Config.User)
 	}
+	if len(container.hostConfig.GroupAdd) > 0 {
+		params = append(params, "-groups", strings.Join(container.hostConfig.GroupAdd, ","))
+	}
+
+	// Resource limits, set by dockerinit before it drops sys_resource,
+	// which raising a hard limit requires
+	if ulimits := container.ulimits(); len(ulimits) > 0 {
+		rawUlimits := make([]string, len(ulimits))
+		for i, ulimit := range ulimits {
+			rawUlimits[i] = ulimit.String()
+		}
+		params = append(params, "-ulimits", strings.Join(rawUlimits, ","))
+		for _, c := range droppedCapabilities(container) {
+			if c == "sys_resource" {
+				params = append(params, "-drop-sys-resource")
+			}
+		}
+	}
+
+	// Init
+	if container.Config.Init {
+		params = append(params, "-init")
+	}
 
 	// Setup environment
 	env := []string{
@@ -793,6 +897,20 @@ func (container *Container) Start() (err error) {
 		)
 	}
 
+	// Mount points of the tmpfs mounts
+	for _, tmpfsPath := range container.tmpfsPaths() {
+		if err := os.MkdirAll(path.Join(container.RootfsPath(), tmpfsPath), 0755); err != nil {
+			return err
+		}
+	}
+
+	// Everything needed in the rootfs must be created before this point
+	if container.hostConfig.ReadonlyRootfs {
+		if err := mountReadonlyRootfs(container.RootfsPath()); err != nil {
+			return fmt.Errorf("Unable to mount the rootfs read-only: %s", err)
+		}
+	}
+
 	// Program
 	params = append(params, "--", container.Path)
 	params = append(params, container.Args...)
@@ -840,8 +958,10 @@ func (container *Container) Start() (err error) {
 	// Init the lock
 	container.waitLock = make(chan struct{})
 
+	stopHealthMonitor := container.startHealthMonitor()
+
 	container.ToDisk()
-	go container.monitor()
+	go container.monitor(stopHealthMonitor)
 
 	defer utils.Debugf("Container running: %v", container.State.IsRunning())
 	// We wait for the container to be fully running.
@@ -1069,7 +1189,7 @@ func (container *Container) waitLxc() error {
 	}
 }
 
-func (container *Container) monitor() {
+func (container *Container) monitor(stopHealthMonitor func()) {
 	// Wait for the program to exit
 
 	// If the command does not exist, try to wait via lxc
@@ -1094,6 +1214,9 @@ func (container *Container) monitor() {
 		exitCode = container.cmd.ProcessState.Sys().(syscall.WaitStatus).ExitStatus()
 	}
 
+	// No health check result or event after the container is reported dead
+	stopHealthMonitor()
+
 	if container.runtime != nil && container.runtime.srv != nil {
 		container.runtime.srv.LogEvent("die", container.ID, container.runtime.repositories.ImageName(container.Image))
 	}
@@ -1151,11 +1274,46 @@ func (container *Container) cleanup() {
 		}
 	}
 
+	container.unmountVolumes()
+	if container.hostConfig != nil && container.hostConfig.ReadonlyRootfs {
+		if err := unmountReadonlyRootfs(container.RootfsPath()); err != nil {
+			utils.Errorf("%s: Error unmounting read-only rootfs: %s", container.ID, err)
+		}
+	}
 	if err := container.Unmount(); err != nil {
 		log.Printf("%v: Failed to umount filesystem: %v", container.ID, err)
 	}
 }
 
+// volume returns the volume mounted at volPath, or nil if it is a bind
+// mount from the host.
+func (container *Container) volume(volPath string) *Volume {
+	if id, exists := container.VolumeIDs[volPath]; exists {
+		volume, err := container.runtime.volumeStore.GetExact(id)
+		if err != nil {
+			return nil
+		}
+		return volume
+	}
+	// Containers which didn't record the IDs only have local volumes
+	return container.runtime.volumeStore.GetByPath(container.Volumes[volPath])
+}
+
+// unmountVolumes tells the volume drivers that the container doesn't
+// use its volumes anymore.
+func (container *Container) unmountVolumes() {
+	if container.runtime == nil || container.runtime.volumeStore == nil {
+		return
+	}
+	for volPath := range container.Volumes {
+		if volume := container.volume(volPath); volume != nil && !volume.isLocal() {
+			if err := container.runtime.volumeStore.Unmount(volume); err != nil {
+				utils.Errorf("%s: Error unmounting volume %s: %s", container.ID, volume.key(), err)
+			}
+		}
+	}
+}
+
 func (container *Container) kill(sig int) error {
 	container.Lock()
 	defer container.Unlock()
@@ -1197,15 +1355,73 @@ func (container *Container) Kill() error {
 	return nil
 }
 
+// stopSignal returns the signal used to gracefully stop the container,
+// SIGTERM unless the config specifies another one.
+func (container *Container) stopSignal() syscall.Signal {
+	if container.Config.StopSignal != "" {
+		if sig, err := utils.ParseSignal(container.Config.StopSignal); err == nil {
+			return sig
+		}
+		utils.Errorf("Invalid stop signal %s for container %s, using SIGTERM", container.Config.StopSignal, container.ID)
+	}
+	return syscall.SIGTERM
+}
+
+// tmpfsPaths returns the paths of the tmpfs mounts of the container
+func (container *Container) tmpfsPaths() []string {
+	if container.hostConfig == nil {
+		return nil
+	}
+	paths := make([]string, 0, len(container.hostConfig.Tmpfs))
+	for p := range container.hostConfig.Tmpfs {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// devicePaths returns the paths of the device nodes created in the
+// container. They are the host's, and left out of its changes and exports.
+func (container *Container) devicePaths() []string {
+	if container.hostConfig == nil {
+		return nil
+	}
+	paths := make([]string, 0, len(container.hostConfig.Devices))
+	for _, mapping := range container.hostConfig.Devices {
+		paths = append(paths, mapping.PathInContainer)
+	}
+	return paths
+}
+
+// ulimits returns the resource limits of the container, completed by
+// the daemon-wide defaults for the resources it doesn't set.
+func (container *Container) ulimits() []*utils.Ulimit {
+	ulimits := container.hostConfig.Ulimits
+	if container.runtime == nil || container.runtime.config == nil {
+		return ulimits
+	}
+	set := make(map[string]bool)
+	for _, ulimit := range ulimits {
+		set[ulimit.Name] = true
+	}
+	for _, ulimit := range container.runtime.config.DefaultUlimits {
+		if !set[ulimit.Name] {
+			ulimits = append(ulimits, ulimit)
+		}
+	}
+	return ulimits
+}
+
 func (container *Container) Stop(seconds int) error {
 	if !container.State.IsRunning() {
 		return nil
 	}
 
-	// 1. Send a SIGTERM
-	if err := container.kill(15); err != nil {
-		utils.Debugf("Error sending kill SIGTERM: %s", err)
-		log.Print("Failed to send SIGTERM to the process, force killing")
+	// 1. Send the stop signal (SIGTERM by default)
+	sig := container.stopSignal()
+	if err := container.kill(int(sig)); err != nil {
+		utils.Debugf("Error sending kill %s: %s", sig, err)
+		log.Printf("Failed to send %s to the process, force killing", sig)
 		if err := container.kill(9); err != nil {
 			return err
 		}
@@ -1213,7 +1429,7 @@ func (container *Container) Stop(seconds int) error {
 
 	// 2. Wait for the process to exit on its own
 	if err := container.WaitTimeout(time.Duration(seconds) * time.Second); err != nil {
-		log.Printf("Container %v failed to exit within %d seconds of SIGTERM - using the force", container.ID, seconds)
+		log.Printf("Container %v failed to exit within %d seconds of %s - using the force", container.ID, seconds, sig)
 		// 3. If it doesn't, then send SIGKILL
 		if err := container.Kill(); err != nil {
 			return err
@@ -1258,7 +1474,15 @@ func (container *Container) Export() (archive.Archive, error) {
 	if err := container.EnsureMounted(); err != nil {
 		return nil, err
 	}
-	return archive.Tar(container.RootfsPath(), archive.Uncompressed)
+	var excludes []string
+	for _, devicePath := range container.devicePaths() {
+		excludes = append(excludes, "."+devicePath)
+	}
+	return archive.TarFilter(container.RootfsPath(), &archive.TarOptions{
+		Compression: archive.Uncompressed,
+		Excludes:    excludes,
+		Recursive:   true,
+	})
 }
 
 func (container *Container) WaitTimeout(timeout time.Duration) error {
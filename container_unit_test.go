@@ -1,7 +1,10 @@
 package docker
 
 import (
+	"github.com/dotcloud/docker/archive"
+	"github.com/dotcloud/docker/utils"
 	"testing"
+	"time"
 )
 
 func TestParseLxcConfOpt(t *testing.T) {
@@ -159,3 +162,176 @@ func TestGetFullName(t *testing.T) {
 		t.Fatal("Error should not be nil")
 	}
 }
+
+func TestValidateCpuset(t *testing.T) {
+	for _, cpuset := range []string{"0", "0,1", "0-3", "0-2,7"} {
+		if err := validateCpuset(cpuset); err != nil {
+			t.Fatalf("Expected %s to be valid, got %s", cpuset, err)
+		}
+	}
+	for _, cpuset := range []string{"", "a", "0,", "3-1", "0-1-2", "-1"} {
+		if err := validateCpuset(cpuset); err == nil {
+			t.Fatalf("Expected %s to be invalid", cpuset)
+		}
+	}
+}
+
+func TestValidateBlkioWeight(t *testing.T) {
+	for _, weight := range []int64{0, 10, 500, 1000} {
+		if err := validateBlkioWeight(weight); err != nil {
+			t.Fatalf("Expected %d to be valid, got %s", weight, err)
+		}
+	}
+	for _, weight := range []int64{-1, 5, 1001} {
+		if err := validateBlkioWeight(weight); err == nil {
+			t.Fatalf("Expected %d to be invalid", weight)
+		}
+	}
+}
+
+func TestParseCapabilities(t *testing.T) {
+	caps, err := parseCapabilities([]string{"NET_ADMIN", "cap_sys_admin", "ALL"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(caps) != 3 || caps[0] != "net_admin" || caps[1] != "sys_admin" || caps[2] != "all" {
+		t.Fatalf("Unexpected capabilities: %v", caps)
+	}
+	if _, err := parseCapabilities([]string{"not_a_capability"}); err == nil {
+		t.Fatal("Expected an error for an unknown capability")
+	}
+}
+
+func TestParseDevice(t *testing.T) {
+	device, err := parseDevice("/dev/fuse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if device.PathOnHost != "/dev/fuse" || device.PathInContainer != "/dev/fuse" || device.CgroupPermissions != "rwm" {
+		t.Fatalf("Unexpected device mapping: %v", device)
+	}
+	device, err = parseDevice("/dev/ttyUSB0:/dev/ttyS0:rw")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if device.PathOnHost != "/dev/ttyUSB0" || device.PathInContainer != "/dev/ttyS0" || device.CgroupPermissions != "rw" {
+		t.Fatalf("Unexpected device mapping: %v", device)
+	}
+	for _, invalid := range []string{"dev/fuse", "/dev/fuse:fuse", "/dev/fuse:/dev/fuse:rx", "/dev/a:/dev/b:r:w"} {
+		if _, err := parseDevice(invalid); err == nil {
+			t.Fatalf("Expected %s to be invalid", invalid)
+		}
+	}
+}
+
+func TestGetDevice(t *testing.T) {
+	device, err := getDevice(DeviceMapping{PathOnHost: "/dev/null", PathInContainer: "/dev/null", CgroupPermissions: "rwm"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if device.Type != "c" || device.Major != 1 || device.Minor != 3 {
+		t.Fatalf("Expected c 1:3, got %s %d:%d", device.Type, device.Major, device.Minor)
+	}
+	if _, err := getDevice(DeviceMapping{PathOnHost: "/dev/doesnotexist"}); err == nil {
+		t.Fatal("Expected an error for a missing device")
+	}
+	if _, err := getDevice(DeviceMapping{PathOnHost: "/etc/hosts"}); err == nil {
+		t.Fatal("Expected an error for a regular file")
+	}
+}
+
+func TestDevMajorMinor(t *testing.T) {
+	for rdev, expected := range map[uint64][2]int64{
+		0x0103:             {1, 3},
+		0x0803:             {8, 3},
+		0x10fe00:           {254, 256},
+		0x000120006783459a: {0x12345, 0x6789a},
+		0xffffffffffffffff: {0xffffffff, 0xffffffff},
+	} {
+		if major, minor := devMajor(rdev), devMinor(rdev); major != expected[0] || minor != expected[1] {
+			t.Errorf("Expected %#x to be %d:%d, got %d:%d", rdev, expected[0], expected[1], major, minor)
+		}
+	}
+}
+
+func TestContainerUlimits(t *testing.T) {
+	container := &Container{
+		hostConfig: &HostConfig{
+			Ulimits: []*utils.Ulimit{{Name: "nofile", Soft: 1024, Hard: 4096}},
+		},
+		runtime: &Runtime{
+			config: &DaemonConfig{
+				DefaultUlimits: []*utils.Ulimit{
+					{Name: "nofile", Soft: 256, Hard: 256},
+					{Name: "nproc", Soft: 512, Hard: 512},
+				},
+			},
+		},
+	}
+	ulimits := container.ulimits()
+	if len(ulimits) != 2 {
+		t.Fatalf("Expected 2 ulimits, got %v", ulimits)
+	}
+	if ulimits[0].String() != "nofile=1024:4096" || ulimits[1].String() != "nproc=512:512" {
+		t.Fatalf("Expected the container's nofile and the default nproc, got %v", ulimits)
+	}
+}
+
+func TestParseTmpfs(t *testing.T) {
+	valid := map[string][2]string{
+		"/tmp":                    {"/tmp", ""},
+		"/run/":                   {"/run", ""},
+		"/run:size=64m":           {"/run", "size=64m"},
+		"/run:size=64m,mode=1777": {"/run", "size=64m,mode=1777"},
+		"/scratch:mode=700":       {"/scratch", "mode=700"},
+	}
+	for raw, expected := range valid {
+		dst, options, err := parseTmpfs(raw)
+		if err != nil {
+			t.Fatalf("Unexpected error for %s: %s", raw, err)
+		}
+		if dst != expected[0] || options != expected[1] {
+			t.Fatalf("Expected %v for %s, got %s %s", expected, raw, dst, options)
+		}
+	}
+	for _, invalid := range []string{"tmp", "/", "/run:size", "/run:size=big", "/run:mode=999", "/run:mode=17777", "/run:noexec", "/run:uid=0"} {
+		if _, _, err := parseTmpfs(invalid); err == nil {
+			t.Fatalf("Expected %s to be invalid", invalid)
+		}
+	}
+}
+
+func TestExcludeChanges(t *testing.T) {
+	changes := []archive.Change{
+		{Path: "/etc", Kind: archive.ChangeModify},
+		{Path: "/etc/passwd", Kind: archive.ChangeModify},
+		{Path: "/run", Kind: archive.ChangeAdd},
+		{Path: "/run/app.pid", Kind: archive.ChangeAdd},
+		{Path: "/runtime", Kind: archive.ChangeAdd},
+		{Path: "/tmp/foo", Kind: archive.ChangeDelete},
+	}
+	filtered := excludeChanges(changes, []string{"/run", "/tmp"})
+	if len(filtered) != 3 || filtered[0].Path != "/etc" || filtered[1].Path != "/etc/passwd" || filtered[2].Path != "/runtime" {
+		t.Fatalf("Unexpected changes: %v", filtered)
+	}
+}
+
+func TestParseRunHealthcheck(t *testing.T) {
+	config, _, _, err := ParseRun([]string{"-health-cmd", "curl -f localhost", "-health-interval", "5s", "-health-retries", "2", "busybox"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.Healthcheck == nil || config.Healthcheck.Interval != 5*time.Second || config.Healthcheck.Retries != 2 {
+		t.Fatalf("Unexpected health check %+v", config.Healthcheck)
+	}
+	// The options of a health check are not ignored without one
+	for _, args := range [][]string{
+		{"-health-interval", "5s", "busybox"},
+		{"-health-timeout", "1s", "busybox"},
+		{"-no-healthcheck", "-health-retries", "2", "busybox"},
+	} {
+		if _, _, _, err := ParseRun(args, nil); err == nil {
+			t.Errorf("Expected %v to be rejected", args)
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package docker
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"strings"
+	"syscall"
+)
+
+// Device is a host device node resolved for a container, as needed
+// both to create the node in the rootfs and to allow it in the
+// devices cgroup.
+type Device struct {
+	Type        string // "c" for character devices, "b" for block devices
+	Major       int64
+	Minor       int64
+	Permissions string // cgroup permissions, any combination of r, w and m
+
+	PathInContainer string
+	mode            uint32
+	rdev            uint64
+}
+
+// Devices come in the format of
+// pathOnHost[:pathInContainer[:permissions]]
+func parseDevice(rawDevice string) (DeviceMapping, error) {
+	var (
+		src, dst string
+		perms    = "rwm"
+		arr      = strings.Split(rawDevice, ":")
+	)
+	switch len(arr) {
+	case 3:
+		perms = arr[2]
+		fallthrough
+	case 2:
+		dst = arr[1]
+		fallthrough
+	case 1:
+		src = arr[0]
+	default:
+		return DeviceMapping{}, fmt.Errorf("Invalid device specification: %s", rawDevice)
+	}
+	if dst == "" {
+		dst = src
+	}
+	if !path.IsAbs(src) || !path.IsAbs(dst) {
+		return DeviceMapping{}, fmt.Errorf("Invalid device specification: %s (paths must be absolute)", rawDevice)
+	}
+	if perms == "" || strings.Trim(perms, "rwm") != "" {
+		return DeviceMapping{}, fmt.Errorf("Invalid device permissions: %s (must be a combination of r, w and m)", perms)
+	}
+	return DeviceMapping{
+		PathOnHost:        path.Clean(src),
+		PathInContainer:   path.Clean(dst),
+		CgroupPermissions: perms,
+	}, nil
+}
+
+// getDevice resolves a device mapping against the host device nodes
+func getDevice(mapping DeviceMapping) (*Device, error) {
+	var stat syscall.Stat_t
+	if err := syscall.Stat(mapping.PathOnHost, &stat); err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("Device %s does not exist on the host", mapping.PathOnHost)
+		}
+		return nil, fmt.Errorf("Unable to stat device %s: %s", mapping.PathOnHost, err)
+	}
+
+	var devType string
+	switch stat.Mode & syscall.S_IFMT {
+	case syscall.S_IFCHR:
+		devType = "c"
+	case syscall.S_IFBLK:
+		devType = "b"
+	default:
+		return nil, fmt.Errorf("%s is not a device node", mapping.PathOnHost)
+	}
+
+	rdev := uint64(stat.Rdev)
+	return &Device{
+		Type:            devType,
+		Major:           devMajor(rdev),
+		Minor:           devMinor(rdev),
+		Permissions:     mapping.CgroupPermissions,
+		PathInContainer: mapping.PathInContainer,
+		mode:            stat.Mode,
+		rdev:            rdev,
+	}, nil
+}
+
+// devMajor and devMinor decode a device number as glibc's gnu_dev_major
+// and gnu_dev_minor do, the high bits of each being above the low 32 bits.
+func devMajor(rdev uint64) int64 {
+	return int64(((rdev >> 8) & 0xfff) | ((rdev >> 32) & 0xfffff000))
+}
+
+func devMinor(rdev uint64) int64 {
+	return int64((rdev & 0xff) | ((rdev >> 12) & 0xffffff00))
+}
+
+// createDeviceNode creates the device node at the given root, replacing
+// any file already present at its path. The node is left out of the
+// changes of the container, see devicePaths.
+func createDeviceNode(root string, device *Device) error {
+	dest := path.Join(root, device.PathInContainer)
+	if err := os.MkdirAll(path.Dir(dest), 0755); err != nil {
+		return err
+	}
+	if err := os.Remove(dest); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := syscall.Mknod(dest, device.mode, int(device.rdev)); err != nil {
+		return fmt.Errorf("Unable to create device node %s: %s", device.PathInContainer, err)
+	}
+	return nil
+}
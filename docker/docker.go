@@ -39,6 +39,8 @@ func main() {
 	flDefaultIp := flag.String("ip", "0.0.0.0", "Default IP address to use when binding container ports")
 	flInterContainerComm := flag.Bool("icc", true, "Enable inter-container communication")
 	flGraphDriver := flag.String("s", "", "Force the docker runtime to use a specific storage driver")
+	var flDefaultUlimits utils.ListOpts
+	flag.Var(&flDefaultUlimits, "default-ulimit", "Default resource limit for containers (format: name=soft[:hard], e.g. nofile=1024:4096)")
 
 	flag.Parse()
 
@@ -58,6 +60,12 @@ func main() {
 		}
 	}
 
+	for _, rawUlimit := range flDefaultUlimits {
+		if _, err := utils.ParseUlimit(rawUlimit); err != nil {
+			log.Fatal(err)
+		}
+	}
+
 	if *flDebug {
 		os.Setenv("DEBUG", "1")
 	}
@@ -84,6 +92,7 @@ func main() {
 		job.Setenv("DefaultIp", *flDefaultIp)
 		job.SetenvBool("InterContainerCommunication", *flInterContainerComm)
 		job.Setenv("GraphDriver", *flGraphDriver)
+		job.SetenvList("DefaultUlimits", flDefaultUlimits)
 		if err := job.Run(); err != nil {
 			log.Fatal(err)
 		}
@@ -17,9 +17,10 @@ import (
 
 // A Graph is a store for versioned filesystem images and the relationship between them.
 type Graph struct {
-	Root    string
-	idIndex *utils.TruncIndex
-	driver  graphdriver.Driver
+	Root     string
+	idIndex  *utils.TruncIndex
+	driver   graphdriver.Driver
+	children *childIndex
 }
 
 // NewGraph instantiates a new graph at the given root path in the filesystem.
@@ -42,6 +43,9 @@ func NewGraph(root string, driver graphdriver.Driver) (*Graph, error) {
 	if err := graph.restore(); err != nil {
 		return nil, err
 	}
+	if err := graph.loadChildIndex(); err != nil {
+		return nil, err
+	}
 	return graph, nil
 }
 
@@ -185,6 +189,10 @@ func (graph *Graph) Register(jsonData []byte, layerData archive.Archive, img *Im
 		return err
 	}
 	graph.idIndex.Add(img.ID)
+	if err := graph.children.add(img); err != nil {
+		// The image is registered, the build cache will only miss it
+		utils.Errorf("Unable to add image %s to the child index: %s", img.ID, err)
+	}
 	return nil
 }
 
@@ -234,6 +242,8 @@ func setupInitLayer(initLayer string) error {
 		"/etc/resolv.conf": "file",
 		"/etc/hosts":       "file",
 		"/etc/hostname":    "file",
+		// lxc can't create its pivot directory in a read-only rootfs
+		"/lxc_putold": "dir",
 		// "var/run": "dir",
 		// "var/lock": "dir",
 	} {
@@ -295,8 +305,16 @@ func (graph *Graph) Delete(name string) error {
 	if err != nil {
 		return err
 	}
+	if img, err := LoadImage(graph.imageRoot(id)); err == nil {
+		if err := graph.children.remove(img); err != nil {
+			// The build cache checks that the images of the index exist
+			utils.Errorf("Unable to remove image %s from the child index: %s", id, err)
+		}
+	}
 	graph.idIndex.Delete(id)
-	err = os.Rename(graph.imageRoot(id), tmp)
+	// os.Rename refuses an existing directory as destination, even an
+	// empty one, so move the image into the temporary directory
+	err = os.Rename(graph.imageRoot(id), path.Join(tmp, id))
 	if err != nil {
 		return err
 	}
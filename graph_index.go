@@ -0,0 +1,125 @@
+package docker
+
+import (
+	"encoding/json"
+	"github.com/dotcloud/docker/utils"
+	"io/ioutil"
+	"os"
+	"path"
+	"sync"
+)
+
+// childIndex maps a parent image ID and the digest of a container config
+// to the images committed from such a container, so that the build cache
+// doesn't have to scan the whole graph. It is persisted next to the images,
+// and only used as a hint: the images it returns must still be checked.
+type childIndex struct {
+	sync.Mutex
+	path     string
+	Children map[string][]string
+}
+
+func childIndexKey(parent, digest string) string {
+	return parent + ":" + digest
+}
+
+// loadChildIndex loads the child index of the graph, building it from
+// the images of the graph if it doesn't exist yet or is corrupted.
+func (graph *Graph) loadChildIndex() error {
+	index := &childIndex{
+		path:     path.Join(graph.Root, "_children.json"),
+		Children: make(map[string][]string),
+	}
+	graph.children = index
+
+	jsonData, err := ioutil.ReadFile(index.path)
+	if err == nil {
+		if err = json.Unmarshal(jsonData, index); err == nil {
+			return nil
+		}
+		utils.Errorf("Rebuilding the corrupted child index %s: %s", index.path, err)
+		index.Children = make(map[string][]string)
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+	files, err := ioutil.ReadDir(graph.Root)
+	if err != nil {
+		return err
+	}
+	for _, st := range files {
+		// Don't use graph.Get, which would have the driver mount every image
+		img, err := LoadImage(graph.imageRoot(st.Name()))
+		if err != nil {
+			continue
+		}
+		key := childIndexKey(img.Parent, configDigest(&img.ContainerConfig))
+		index.Children[key] = append(index.Children[key], img.ID)
+	}
+	return index.save()
+}
+
+func (index *childIndex) save() error {
+	jsonData, err := json.Marshal(index)
+	if err != nil {
+		return err
+	}
+	// Write to a temporary file first, a crash must not truncate the index
+	tmp := index.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, jsonData, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, index.path)
+}
+
+func (index *childIndex) add(img *Image) error {
+	index.Lock()
+	defer index.Unlock()
+
+	key := childIndexKey(img.Parent, configDigest(&img.ContainerConfig))
+	index.Children[key] = append(index.Children[key], img.ID)
+	return index.save()
+}
+
+func (index *childIndex) remove(img *Image) error {
+	index.Lock()
+	defer index.Unlock()
+
+	key := childIndexKey(img.Parent, configDigest(&img.ContainerConfig))
+	ids := index.Children[key]
+	for i, id := range ids {
+		if id == img.ID {
+			ids = append(ids[:i], ids[i+1:]...)
+			break
+		}
+	}
+	if len(ids) == 0 {
+		delete(index.Children, key)
+	} else {
+		index.Children[key] = ids
+	}
+	return index.save()
+}
+
+func (index *childIndex) get(parent string, config *Config) []string {
+	index.Lock()
+	defer index.Unlock()
+
+	ids := index.Children[childIndexKey(parent, configDigest(config))]
+	return append([]string(nil), ids...)
+}
+
+// GetCachedChild returns an image of the graph which was committed from a
+// container of the parent image with the given config, or nil if none.
+func (graph *Graph) GetCachedChild(parent string, config *Config) (*Image, error) {
+	for _, id := range graph.children.get(parent, config) {
+		img, err := graph.Get(id)
+		if err != nil {
+			// The index may be out of date after a crash
+			continue
+		}
+		if img.Parent == parent && CompareConfig(&img.ContainerConfig, config) {
+			return img, nil
+		}
+	}
+	return nil, nil
+}
@@ -0,0 +1,140 @@
+package docker
+
+import (
+	"github.com/dotcloud/docker/graphdriver"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+	"time"
+)
+
+func tempGraph(t *testing.T, root string) *Graph {
+	driver, err := graphdriver.GetDriver("vfs", root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	graph, err := NewGraph(path.Join(root, "graph"), driver)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return graph
+}
+
+func TestGraphChildIndex(t *testing.T) {
+	root, err := ioutil.TempDir("", "TestGraphChildIndex")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	graph := tempGraph(t, root)
+	parent := &Image{ID: GenerateID(), Created: time.Now()}
+	if err := graph.Register(nil, nil, parent); err != nil {
+		t.Fatal(err)
+	}
+	config := Config{Cmd: []string{"/bin/sh", "-c", "make"}}
+	child := &Image{ID: GenerateID(), Parent: parent.ID, ContainerConfig: config, Created: time.Now()}
+	if err := graph.Register(nil, nil, child); err != nil {
+		t.Fatal(err)
+	}
+
+	lookup := func(graph *Graph, config Config) *Image {
+		img, err := graph.GetCachedChild(parent.ID, &config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return img
+	}
+	if img := lookup(graph, config); img == nil || img.ID != child.ID {
+		t.Fatalf("Expected the cached child %s, got %v", child.ID, img)
+	}
+	if img := lookup(graph, Config{Cmd: []string{"/bin/sh", "-c", "make install"}}); img != nil {
+		t.Fatalf("Expected no cached child for another config, got %s", img.ID)
+	}
+
+	// The index is persisted, and rebuilt if missing
+	if img := lookup(tempGraph(t, root), config); img == nil || img.ID != child.ID {
+		t.Fatalf("Expected the persisted index to have the child %s", child.ID)
+	}
+	if err := os.Remove(path.Join(root, "graph", "_children.json")); err != nil {
+		t.Fatal(err)
+	}
+	graph = tempGraph(t, root)
+	if img := lookup(graph, config); img == nil || img.ID != child.ID {
+		t.Fatalf("Expected the rebuilt index to have the child %s", child.ID)
+	}
+	// A truncated index is rebuilt as well
+	if err := ioutil.WriteFile(path.Join(root, "graph", "_children.json"), []byte(`{"Children":{"`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	graph = tempGraph(t, root)
+	if img := lookup(graph, config); img == nil || img.ID != child.ID {
+		t.Fatalf("Expected the rebuilt index to have the child %s", child.ID)
+	}
+
+	if err := graph.Delete(child.ID); err != nil {
+		t.Fatal(err)
+	}
+	if img := lookup(graph, config); img != nil {
+		t.Fatalf("Expected no cached child once deleted, got %s", img.ID)
+	}
+	if len(graph.children.Children) != 1 {
+		t.Fatalf("Expected only the parent in the index, got %v", graph.children.Children)
+	}
+}
+
+func TestGraphDelete(t *testing.T) {
+	root, err := ioutil.TempDir("", "TestGraphDelete")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	graph := tempGraph(t, root)
+	img := &Image{ID: GenerateID(), Created: time.Now()}
+	if err := graph.Register(nil, nil, img); err != nil {
+		t.Fatal(err)
+	}
+	if err := graph.Delete(img.ID); err != nil {
+		t.Fatal(err)
+	}
+	if graph.Exists(img.ID) {
+		t.Fatalf("Expected %s to be deleted", img.ID)
+	}
+	if _, err := os.Stat(graph.imageRoot(img.ID)); !os.IsNotExist(err) {
+		t.Fatalf("Expected the directory of %s to be removed, got %v", img.ID, err)
+	}
+
+	// Failing to save the child index doesn't prevent the deletion
+	img = &Image{ID: GenerateID(), Created: time.Now()}
+	if err := graph.Register(nil, nil, img); err != nil {
+		t.Fatal(err)
+	}
+	graph.children.path = path.Join(root, "doesnotexist", "_children.json")
+	if err := graph.Delete(img.ID); err != nil {
+		t.Fatal(err)
+	}
+	if graph.Exists(img.ID) {
+		t.Fatalf("Expected %s to be deleted", img.ID)
+	}
+}
+
+func TestSetupInitLayer(t *testing.T) {
+	root, err := ioutil.TempDir("", "TestSetupInitLayer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	if err := setupInitLayer(root); err != nil {
+		t.Fatal(err)
+	}
+	for pth, isDir := range map[string]bool{"/proc": true, "/lxc_putold": true, "/etc/hosts": false, "/.dockerinit": false} {
+		if st, err := os.Stat(path.Join(root, pth)); err != nil {
+			t.Error(err)
+		} else if st.IsDir() != isDir {
+			t.Errorf("Expected %s to be a directory: %v", pth, isDir)
+		}
+	}
+}
@@ -0,0 +1,187 @@
+package docker
+
+import (
+	"fmt"
+	"github.com/dotcloud/docker/utils"
+	"io/ioutil"
+	"os/exec"
+	"syscall"
+	"time"
+)
+
+// Health statuses reported in State.Health
+const (
+	HealthStarting = "starting"
+	Healthy        = "healthy"
+	Unhealthy      = "unhealthy"
+)
+
+const (
+	defaultHealthInterval = 30 * time.Second
+	defaultHealthTimeout  = 30 * time.Second
+	defaultHealthRetries  = 3
+
+	// Only the most recent results are kept in State.Health.Log,
+	// each of them with a truncated output.
+	maxHealthLogEntries = 5
+	maxHealthOutputSize = 4096
+)
+
+type HealthConfig struct {
+	Test     []string      // Command run inside the container, ["NONE"] disables an inherited check
+	Interval time.Duration // Time to wait between two checks (0 means the default)
+	Timeout  time.Duration // Time after which a running check is considered failed (0 means the default)
+	Retries  int           // Consecutive failures needed to report unhealthy (0 means the default)
+}
+
+type HealthcheckResult struct {
+	Start    time.Time
+	End      time.Time
+	ExitCode int
+	Output   string
+}
+
+type Health struct {
+	Status        string
+	FailingStreak int
+	Log           []*HealthcheckResult
+}
+
+// IsDisabled returns true if the config does not define a health check
+func (config *HealthConfig) IsDisabled() bool {
+	return config == nil || len(config.Test) == 0 || (len(config.Test) == 1 && config.Test[0] == "NONE")
+}
+
+func (config *HealthConfig) interval() time.Duration {
+	if config.Interval > 0 {
+		return config.Interval
+	}
+	return defaultHealthInterval
+}
+
+func (config *HealthConfig) timeout() time.Duration {
+	if config.Timeout > 0 {
+		return config.Timeout
+	}
+	return defaultHealthTimeout
+}
+
+func (config *HealthConfig) retries() int {
+	if config.Retries > 0 {
+		return config.Retries
+	}
+	return defaultHealthRetries
+}
+
+func compareHealthConfig(a, b *HealthConfig) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	if a.Interval != b.Interval || a.Timeout != b.Timeout || a.Retries != b.Retries || len(a.Test) != len(b.Test) {
+		return false
+	}
+	for i := 0; i < len(a.Test); i++ {
+		if a.Test[i] != b.Test[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// startHealthMonitor starts probing the container if its config defines a health check.
+// It must be called with the container running. It returns the function stopping
+// the probes, which returns once the last result is recorded.
+func (container *Container) startHealthMonitor() func() {
+	config := container.Config.Healthcheck
+	if config.IsDisabled() {
+		container.State.SetHealth(nil)
+		return func() {}
+	}
+	container.State.SetHealth(&Health{Status: HealthStarting})
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		container.healthMonitor(config, stop)
+		close(done)
+	}()
+	return func() {
+		close(stop)
+		<-done
+	}
+}
+
+func (container *Container) healthMonitor(config *HealthConfig, stop chan struct{}) {
+	utils.Debugf("health: monitoring container %s every %s", container.ID, config.interval())
+	for {
+		select {
+		case <-stop:
+			utils.Debugf("health: stop monitoring container %s", container.ID)
+			return
+		case <-time.After(config.interval()):
+		}
+
+		result := container.probeHealth(config.Test, config.timeout(), stop)
+		if result == nil {
+			utils.Debugf("health: stop monitoring container %s", container.ID)
+			return
+		}
+		if status, changed := container.State.AddHealthResult(result, config.retries()); changed {
+			utils.Debugf("health: container %s is now %s", container.ID, status)
+			if container.runtime != nil && container.runtime.srv != nil {
+				container.runtime.srv.LogEvent("health_status: "+status, container.ID, container.runtime.repositories.ImageName(container.Image))
+			}
+		}
+	}
+}
+
+// probeHealth runs the health check command inside the container. It returns
+// nil if the monitor is stopped before the check ends.
+func (container *Container) probeHealth(test []string, timeout time.Duration, stop chan struct{}) *HealthcheckResult {
+	result := &HealthcheckResult{Start: time.Now().UTC(), ExitCode: -1}
+
+	cmd := exec.Command("lxc-attach", append([]string{"-n", container.ID, "--"}, test...)...)
+	// lxc-attach doesn't forward the signals it gets, the check it runs
+	// in the container is only killed along with its process group.
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	pipe, err := cmd.StdoutPipe()
+	if err == nil {
+		cmd.Stderr = cmd.Stdout
+		err = cmd.Start()
+	}
+	if err != nil {
+		result.End = time.Now().UTC()
+		result.Output = fmt.Sprintf("Unable to run health check: %s", err)
+		return result
+	}
+
+	// The output is read until the pipe is closed, which a process left
+	// in the background by the check can delay past its exit.
+	output := make(chan []byte, 1)
+	go func() {
+		data, _ := ioutil.ReadAll(pipe)
+		output <- data
+	}()
+
+	select {
+	case data := <-output:
+		cmd.Wait()
+		result.ExitCode = cmd.ProcessState.Sys().(syscall.WaitStatus).ExitStatus()
+		result.Output = string(data)
+	case <-time.After(timeout):
+		syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+		// Wait closes the pipe, no need to wait for the output
+		cmd.Wait()
+		result.Output = fmt.Sprintf("Health check exceeded timeout (%s)", timeout)
+	case <-stop:
+		syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+		cmd.Wait()
+		return nil
+	}
+	result.End = time.Now().UTC()
+
+	if len(result.Output) > maxHealthOutputSize {
+		result.Output = result.Output[:maxHealthOutputSize]
+	}
+	return result
+}
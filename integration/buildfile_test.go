@@ -11,6 +11,7 @@ import (
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 )
 
 // mkTestContext generates a build context from the contents of the provided dockerfile.
@@ -262,7 +263,7 @@ func buildImage(context testContextTemplate, t *testing.T, eng *engine.Engine, u
 	}
 	dockerfile := constructDockerfile(context.dockerfile, ip, port)
 
-	buildfile := docker.NewBuildFile(srv, ioutil.Discard, false, useCache, false)
+	buildfile := docker.NewBuildFile(srv, ioutil.Discard, false, useCache, false, nil, "")
 	id, err := buildfile.Build(mkTestContext(dockerfile, context.files, t))
 	if err != nil {
 		t.Fatal(err)
@@ -349,6 +350,24 @@ func TestBuildCmd(t *testing.T) {
 	}
 }
 
+func TestBuildHealthcheck(t *testing.T) {
+	img := buildImage(testContextTemplate{`
+        from {IMAGE}
+        healthcheck -interval=5s -retries=2 CMD cat /etc/hostname
+        `,
+		nil, nil}, t, nil, true)
+
+	if img.Config.Healthcheck == nil {
+		t.Fatal("Expected a health check in the image config")
+	}
+	if img.Config.Healthcheck.Test[2] != "cat /etc/hostname" {
+		t.Fatalf("Unexpected health check command: %v", img.Config.Healthcheck.Test)
+	}
+	if img.Config.Healthcheck.Interval != 5*time.Second || img.Config.Healthcheck.Retries != 2 {
+		t.Fatalf("Unexpected health check options: %v", img.Config.Healthcheck)
+	}
+}
+
 func TestBuildExpose(t *testing.T) {
 	img := buildImage(testContextTemplate{`
         from {IMAGE}
@@ -441,6 +460,70 @@ func TestBuildImageWithoutCache(t *testing.T) {
 	}
 }
 
+func TestBuildADDLocalFileWithCache(t *testing.T) {
+	eng := NewTestEngine(t)
+	defer nuke(mkRuntimeFromEngine(eng, t))
+
+	template := testContextTemplate{`
+        from {IMAGE}
+        add foo /usr/lib/bla/bar
+        `,
+		[][2]string{{"foo", "hello"}}, nil}
+
+	id1 := buildImage(template, t, eng, true).ID
+	if id2 := buildImage(template, t, eng, true).ID; id1 != id2 {
+		t.Fatalf("Expected the unchanged file to use the cache: %s != %s", id1, id2)
+	}
+	template.files = [][2]string{{"foo", "hello world"}}
+	if id3 := buildImage(template, t, eng, true).ID; id1 == id3 {
+		t.Fatalf("Expected the changed file not to use the cache")
+	}
+}
+
+func TestBuildADDRemoteFileWithCache(t *testing.T) {
+	eng := NewTestEngine(t)
+	defer nuke(mkRuntimeFromEngine(eng, t))
+	srv := mkServerFromEngine(eng, t)
+
+	content := "hello"
+	listener, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	httpServer := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(content))
+	}))
+	httpServer.Listener = listener
+	httpServer.Start()
+	defer httpServer.Close()
+
+	port := httpServer.URL[strings.LastIndex(httpServer.URL, ":")+1:]
+	ip, ok := eng.Hack_GetGlobalVar("httpapi.bridgeIP").(net.IP)
+	if !ok {
+		t.Fatal("Legacy bridgeIP field not set in engine")
+	}
+	dockerfile := constructDockerfile(`
+        from {IMAGE}
+        add http://{SERVERADDR}/baz /usr/lib/baz/quux
+        `, ip, port)
+
+	build := func() string {
+		id, err := docker.NewBuildFile(srv, ioutil.Discard, false, true, false, nil, "").Build(mkTestContext(dockerfile, nil, t))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return id
+	}
+	id1 := build()
+	if id2 := build(); id1 != id2 {
+		t.Fatalf("Expected the unchanged remote file to use the cache: %s != %s", id1, id2)
+	}
+	content = "hello world"
+	if id3 := build(); id1 == id3 {
+		t.Fatalf("Expected the changed remote file not to use the cache")
+	}
+}
+
 func TestForbiddenContextPath(t *testing.T) {
 	eng := NewTestEngine(t)
 	defer nuke(mkRuntimeFromEngine(eng, t))
@@ -475,7 +558,7 @@ func TestForbiddenContextPath(t *testing.T) {
 	}
 	dockerfile := constructDockerfile(context.dockerfile, ip, port)
 
-	buildfile := docker.NewBuildFile(srv, ioutil.Discard, false, true, false)
+	buildfile := docker.NewBuildFile(srv, ioutil.Discard, false, true, false, nil, "")
 	_, err = buildfile.Build(mkTestContext(dockerfile, context.files, t))
 
 	if err == nil {
@@ -521,7 +604,7 @@ func TestBuildADDFileNotFound(t *testing.T) {
 	}
 	dockerfile := constructDockerfile(context.dockerfile, ip, port)
 
-	buildfile := docker.NewBuildFile(mkServerFromEngine(eng, t), ioutil.Discard, false, true, false)
+	buildfile := docker.NewBuildFile(mkServerFromEngine(eng, t), ioutil.Discard, false, true, false, nil, "")
 	_, err = buildfile.Build(mkTestContext(dockerfile, context.files, t))
 
 	if err == nil {
@@ -561,3 +644,279 @@ func TestBuildInheritance(t *testing.T) {
 		t.Fail()
 	}
 }
+
+func TestBuildMultiStage(t *testing.T) {
+	eng := NewTestEngine(t)
+	defer nuke(mkRuntimeFromEngine(eng, t))
+
+	img := buildImage(testContextTemplate{`
+        from {IMAGE} as builder
+        run sh -c 'echo built > /tmp/artifact'
+        run sh -c 'echo unused > /tmp/unused'
+        run ln -s / /h
+        from {IMAGE}
+        run sh -c 'echo other > /tmp/other'
+        from builder
+        run [ -f /tmp/unused ]
+        from {IMAGE}
+        add --from=builder /tmp/artifact /artifact
+        add --from=1 /tmp/other /other
+        add --from=builder /h/tmp/artifact /linked
+        run [ "$(cat /artifact)" = "built" ]
+        run [ "$(cat /other)" = "other" ]
+        run [ "$(cat /linked)" = "built" ]
+        entrypoint ["/bin/echo"]
+        `,
+		nil, nil}, t, eng, true)
+
+	base, err := mkServerFromEngine(eng, t).ImageInspect(unitTestImageID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	baseHistory, err := base.History()
+	if err != nil {
+		t.Fatal(err)
+	}
+	history, err := img.History()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Only the layers of the last stage end up in the image
+	if len(history) != len(baseHistory)+7 {
+		t.Fatalf("Expected the image to have %d layers, got %d", len(baseHistory)+7, len(history))
+	}
+	if img.Config.Entrypoint[0] != "/bin/echo" {
+		t.Fail()
+	}
+}
+
+func TestBuildMultiStageErrors(t *testing.T) {
+	eng := NewTestEngine(t)
+	defer nuke(mkRuntimeFromEngine(eng, t))
+
+	for dockerfile, expected := range map[string]string{
+		"from {IMAGE} as builder\nfrom {IMAGE} as builder\n":              "Conflict, the build stage name builder is already in use",
+		"from {IMAGE} as 1\n":                                             "Invalid build stage name: 1, numbers are reserved for stage indexes",
+		"from {IMAGE} as -builder\n":                                      "Invalid build stage name: -builder, only [a-zA-Z0-9_.-] are allowed, starting with a letter",
+		"from {IMAGE} with builder\n":                                     "Invalid FROM format",
+		"from {IMAGE}\nadd --from=builder /etc/passwd /passwd\n":          "No such build stage: builder",
+		"from {IMAGE}\nfrom {IMAGE}\nadd --from=0 /does/not/exist /foo\n": "/does/not/exist: no such file or directory in build stage 0",
+	} {
+		buildfile := docker.NewBuildFile(mkServerFromEngine(eng, t), ioutil.Discard, false, true, true, nil, "")
+		_, err := buildfile.Build(mkTestContext(constructDockerfile(dockerfile, nil, ""), nil, t))
+		if err == nil || err.Error() != expected {
+			t.Errorf("Expected the error %q for %q, got %v", expected, dockerfile, err)
+		}
+	}
+}
+
+func TestBuildArg(t *testing.T) {
+	eng := NewTestEngine(t)
+	defer nuke(mkRuntimeFromEngine(eng, t))
+	srv := mkServerFromEngine(eng, t)
+
+	dockerfile := constructDockerfile(`
+        from {IMAGE}
+        arg VERSION=1.0
+        arg PROXY
+        arg EXPECTED
+        add foo /opt/app-$VERSION/foo
+        run [ "$VERSION" = "$EXPECTED" ] && [ -f /opt/app-$VERSION/foo ]
+        `, nil, "")
+
+	build := func(buildArgs map[string]string) *docker.Image {
+		id, err := docker.NewBuildFile(srv, ioutil.Discard, false, true, false, buildArgs, "").Build(mkTestContext(dockerfile, [][2]string{{"foo", "bar"}}, t))
+		if err != nil {
+			t.Fatal(err)
+		}
+		img, err := srv.ImageInspect(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return img
+	}
+
+	img1 := build(map[string]string{"EXPECTED": "1.0"})
+	for _, env := range img1.Config.Env {
+		if strings.HasPrefix(env, "VERSION=") || strings.HasPrefix(env, "PROXY=") {
+			t.Fatalf("Expected the build arguments not to be in the image config, got %s", env)
+		}
+	}
+	if img2 := build(map[string]string{"EXPECTED": "1.0"}); img2.ID != img1.ID {
+		t.Fatalf("Expected the same build arguments to use the cache: %s != %s", img1.ID, img2.ID)
+	}
+	if img3 := build(map[string]string{"EXPECTED": "2.0", "VERSION": "2.0"}); img3.ID == img1.ID {
+		t.Fatal("Expected different build arguments not to use the cache")
+	}
+}
+
+func TestBuildArgFrom(t *testing.T) {
+	eng := NewTestEngine(t)
+	defer nuke(mkRuntimeFromEngine(eng, t))
+	srv := mkServerFromEngine(eng, t)
+
+	// The arguments declared before FROM are only visible to FROM,
+	// unless declared again
+	dockerfile := constructDockerfile(`
+        arg BASE={IMAGE}
+        from $BASE
+        run [ -z "$BASE" ]
+        arg BASE
+        run [ "$BASE" = "{IMAGE}" ]
+        `, nil, "")
+	id, err := docker.NewBuildFile(srv, ioutil.Discard, false, true, false, nil, "").Build(mkTestContext(dockerfile, nil, t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := srv.ImageInspect(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if img.Parent == "" {
+		t.Fatal("Expected the image to be built on the base image")
+	}
+
+	// Declared without a value
+	dockerfile = constructDockerfile("arg BASE\nfrom $BASE\n", nil, "")
+	if _, err := docker.NewBuildFile(srv, ioutil.Discard, false, true, false, nil, "").Build(mkTestContext(dockerfile, nil, t)); err == nil || err.Error() != "Invalid FROM format: $BASE doesn't name an image" {
+		t.Fatalf("Expected an error for an empty base image, got %v", err)
+	}
+}
+
+func TestBuildOnBuild(t *testing.T) {
+	eng := NewTestEngine(t)
+	defer nuke(mkRuntimeFromEngine(eng, t))
+	srv := mkServerFromEngine(eng, t)
+
+	img := buildImage(testContextTemplate{`
+        from {IMAGE}
+        onbuild add foo /app/foo
+        onbuild run [ "$(cat /app/foo)" = "bar" ]
+        `,
+		nil, nil}, t, eng, true)
+
+	if len(img.Config.OnBuild) != 2 || img.Config.OnBuild[0] != "ADD foo /app/foo" {
+		t.Fatalf("Unexpected build triggers: %v", img.Config.OnBuild)
+	}
+	history, err := srv.ImageHistory(img.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(history[0].CreatedBy, "ONBUILD RUN") {
+		t.Fatalf("Expected the history to show the build trigger, got %s", history[0].CreatedBy)
+	}
+
+	img2 := buildImage(testContextTemplate{fmt.Sprintf(`
+        from %s
+        run [ -f /app/foo ]
+        `, img.ID),
+		[][2]string{{"foo", "bar"}}, nil}, t, eng, true)
+
+	// The triggers are not inherited by the images built from the image
+	if len(img2.Config.OnBuild) != 0 {
+		t.Fatalf("Expected the build triggers not to be inherited, got %v", img2.Config.OnBuild)
+	}
+}
+
+func TestBuildExecForm(t *testing.T) {
+	eng := NewTestEngine(t)
+	defer nuke(mkRuntimeFromEngine(eng, t))
+
+	img := buildImage(testContextTemplate{`
+        from {IMAGE}
+        run ["/bin/touch", "/exec"]
+        cmd ["/bin/ls", "/exec"]
+        entrypoint /bin/echo
+        `,
+		nil, nil}, t, eng, true)
+
+	parent, err := img.GetParent()
+	if err != nil {
+		t.Fatal(err)
+	}
+	run, err := parent.GetParent()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The exec form is run without a shell
+	if strings.Join(run.ContainerConfig.Cmd, " ") != "/bin/touch /exec" {
+		t.Fatalf("Unexpected RUN command: %v", run.ContainerConfig.Cmd)
+	}
+	if strings.Join(img.Config.Cmd, " ") != "/bin/ls /exec" {
+		t.Fatalf("Unexpected CMD: %v", img.Config.Cmd)
+	}
+	if strings.Join(img.Config.Entrypoint, " ") != "/bin/sh -c /bin/echo" {
+		t.Fatalf("Unexpected ENTRYPOINT: %v", img.Config.Entrypoint)
+	}
+
+	buildfile := docker.NewBuildFile(mkServerFromEngine(eng, t), ioutil.Discard, false, true, true, nil, "")
+	_, err = buildfile.Build(mkTestContext(constructDockerfile("from {IMAGE}\n\n# Not a command\nrun []\n", nil, ""), nil, t))
+	if err == nil || err.Error() != "Dockerfile line 4: RUN requires a command, got an empty JSON array" {
+		t.Fatalf("Expected the error to point to line 4, got %v", err)
+	}
+}
+
+func TestBuildCheck(t *testing.T) {
+	eng := NewTestEngine(t)
+	defer nuke(mkRuntimeFromEngine(eng, t))
+	srv := mkServerFromEngine(eng, t)
+
+	// Nothing is run, not even FROM, which ARG may come before as on build
+	for _, dockerfile := range []string{"from does-not-exist\nrun exit 1\n", "arg VERSION=1\nfrom does-not-exist\n"} {
+		context := mkTestContext(dockerfile, nil, t)
+		if err := docker.NewBuildFile(srv, ioutil.Discard, false, true, false, nil, "").Check(context); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for dockerfile, expected := range map[string]string{
+		"from {IMAGE}\nrun true\nfoo bar\n": "Dockerfile line 3: unknown instruction FOO",
+		"\n# Comment\nrun true\n":           "Dockerfile line 3: the first instruction must be FROM, after ARG if any",
+		"arg VERSION\nrun true\n":           "Dockerfile line 2: the first instruction must be FROM, after ARG if any",
+		"arg VERSION\n":                     "Dockerfile line 1: the first instruction must be FROM, after ARG if any",
+	} {
+		context := mkTestContext(constructDockerfile(dockerfile, nil, ""), nil, t)
+		if err := docker.NewBuildFile(srv, ioutil.Discard, false, true, false, nil, "").Check(context); err == nil || err.Error() != expected {
+			t.Errorf("Expected the error %q for %q, got %v", expected, dockerfile, err)
+		}
+	}
+
+	// Unknown instructions fail the build before anything is run
+	context := mkTestContext(constructDockerfile("from {IMAGE}\nrun true\nfoo bar\n", nil, ""), nil, t)
+	if _, err := docker.NewBuildFile(srv, ioutil.Discard, false, true, false, nil, "").Build(context); err == nil || err.Error() != "Dockerfile line 3: unknown instruction FOO" {
+		t.Fatalf("Expected the build to fail on line 3, got %v", err)
+	}
+}
+
+func TestBuildDockerfilePath(t *testing.T) {
+	eng := NewTestEngine(t)
+	defer nuke(mkRuntimeFromEngine(eng, t))
+	srv := mkServerFromEngine(eng, t)
+
+	files := [][2]string{
+		{"services/Dockerfile.worker", constructDockerfile("from {IMAGE}\nadd foo /foo\nentrypoint [\"/bin/worker\"]\n", nil, "")},
+		{"foo", "bar"},
+	}
+	id, err := docker.NewBuildFile(srv, ioutil.Discard, false, true, false, nil, "services/Dockerfile.worker").Build(mkTestContext(constructDockerfile("from {IMAGE}\n", nil, ""), files, t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := srv.ImageInspect(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(img.Config.Entrypoint) != 1 || img.Config.Entrypoint[0] != "/bin/worker" {
+		t.Fatalf("Expected the image to be built from services/Dockerfile.worker, got %v", img.Config.Entrypoint)
+	}
+
+	for dockerfile, expected := range map[string]string{
+		"Dockerfile.api": "Can't build a directory with no Dockerfile.api",
+		"../Dockerfile":  "Forbidden path: ../Dockerfile",
+		"services/../..": "Forbidden path: services/../..",
+	} {
+		_, err := docker.NewBuildFile(srv, ioutil.Discard, false, true, false, nil, dockerfile).Build(mkTestContext(constructDockerfile("from {IMAGE}\n", nil, ""), files, t))
+		if err == nil || err.Error() != expected {
+			t.Errorf("Expected the error %q for %s, got %v", expected, dockerfile, err)
+		}
+	}
+}
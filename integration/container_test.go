@@ -1259,6 +1259,20 @@ func TestBindMounts(t *testing.T) {
 	}
 }
 
+func TestReadonlyRootfs(t *testing.T) {
+	eng := NewTestEngine(t)
+	r := mkRuntimeFromEngine(eng, t)
+	defer r.Nuke()
+
+	stdout, _ := runContainer(eng, r, []string{"-read-only", "-v", "/data", "_", "sh", "-c", "touch /foo 2>&1; cat /etc/hostname > /data/hostname && echo written"}, t)
+	if !strings.Contains(stdout, "Read-only file system") {
+		t.Fatalf("Expected writing to the rootfs to fail, got %q", stdout)
+	}
+	if !strings.Contains(stdout, "written") {
+		t.Fatalf("Expected writing to a volume to succeed, got %q", stdout)
+	}
+}
+
 // Test that -volumes-from supports both read-only mounts
 func TestFromVolumesInReadonlyMode(t *testing.T) {
 	runtime := mkRuntime(t)
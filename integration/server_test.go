@@ -1,9 +1,11 @@
 package docker
 
 import (
+	"bytes"
 	"github.com/dotcloud/docker"
 	"github.com/dotcloud/docker/utils"
 	"io/ioutil"
+	"path"
 	"strings"
 	"testing"
 )
@@ -94,7 +96,7 @@ func TestCreateRm(t *testing.T) {
 		t.Errorf("Expected 1 container, %v found", len(c))
 	}
 
-	if err = srv.ContainerDestroy(id, true, false); err != nil {
+	if _, err = srv.ContainerDestroy(id, true, false); err != nil {
 		t.Fatal(err)
 	}
 
@@ -133,7 +135,7 @@ func TestCreateRmVolumes(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	if err = srv.ContainerDestroy(id, true, false); err != nil {
+	if _, err = srv.ContainerDestroy(id, true, false); err != nil {
 		t.Fatal(err)
 	}
 
@@ -142,6 +144,259 @@ func TestCreateRmVolumes(t *testing.T) {
 	}
 }
 
+func TestNamedVolumes(t *testing.T) {
+	eng := NewTestEngine(t)
+	srv := mkServerFromEngine(eng, t)
+	defer mkRuntimeFromEngine(eng, t).Nuke()
+
+	if _, err := srv.VolumeCreate("data", ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := srv.VolumeCreate("data", ""); err == nil {
+		t.Fatal("Expected an error when creating a volume twice")
+	}
+	if _, err := srv.VolumeCreate("not/valid", ""); err == nil {
+		t.Fatal("Expected an error for an invalid volume name")
+	}
+
+	config, hostConfig, _, err := docker.ParseRun([]string{"-v", "data:/data", unitTestImageID, "sh", "-c", "echo hello > /data/hello"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := createTestContainer(eng, config, t)
+	job := eng.Job("start", id)
+	if err := job.ImportEnv(hostConfig); err != nil {
+		t.Fatal(err)
+	}
+	if err := job.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := srv.ContainerWait(id); err != nil {
+		t.Fatal(err)
+	}
+
+	volume, err := srv.VolumeInspect("data")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(volume.Containers) != 1 || volume.Containers[0] != mkRuntimeFromEngine(eng, t).Get(id).ID {
+		t.Fatalf("Expected the volume to be used by %s, got %v", id, volume.Containers)
+	}
+	readFile(path.Join(volume.Path, "hello"), t)
+
+	// A volume in use can't be removed
+	if err := srv.VolumeDestroy("data"); err == nil {
+		t.Fatal("Expected an error when removing a volume in use")
+	}
+
+	// Named volumes survive the removal of their containers, even with -v
+	if _, err := srv.ContainerDestroy(id, true, false); err != nil {
+		t.Fatal(err)
+	}
+	volumes, err := srv.Volumes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(volumes) != 1 || volumes[0].Name != "data" || len(volumes[0].Containers) != 0 {
+		t.Fatalf("Expected the unused volume data, got %v", volumes)
+	}
+
+	if err := srv.VolumeDestroy("data"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := srv.VolumeInspect("data"); err == nil {
+		t.Fatal("Expected the volume to be removed")
+	}
+}
+
+func TestVolumesPrune(t *testing.T) {
+	eng := NewTestEngine(t)
+	srv := mkServerFromEngine(eng, t)
+	defer mkRuntimeFromEngine(eng, t).Nuke()
+
+	used, err := srv.VolumeCreate("used", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	named, err := srv.VolumeCreate("named", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	anonymous, err := srv.VolumeCreate("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config, hostConfig, _, err := docker.ParseRun([]string{"-v", "used:/data", unitTestImageID, "true"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := createTestContainer(eng, config, t)
+	job := eng.Job("start", id)
+	if err := job.ImportEnv(hostConfig); err != nil {
+		t.Fatal(err)
+	}
+	if err := job.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := srv.ContainerWait(id); err != nil {
+		t.Fatal(err)
+	}
+
+	// A dry run reports the unused anonymous volumes without removing them
+	out, err := srv.VolumesPrune(false, true, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(out.Volumes) != 1 || out.Volumes[0].ID != anonymous.ID {
+		t.Fatalf("Expected the anonymous volume %s to be pruned, got %v", anonymous.ID, out.Volumes)
+	}
+	if _, err := srv.VolumeInspect(anonymous.ID); err != nil {
+		t.Fatalf("Expected a dry run not to remove any volume: %s", err)
+	}
+
+	// Only the confirmed volumes are removed
+	out, err = srv.VolumesPrune(true, false, []string{named.ID, used.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(out.Volumes) != 1 || out.Volumes[0].ID != named.ID {
+		t.Fatalf("Expected the named volume %s to be pruned, got %v", named.ID, out.Volumes)
+	}
+	for _, name := range []string{"used", anonymous.ID} {
+		if _, err := srv.VolumeInspect(name); err != nil {
+			t.Fatalf("Expected volume %s to be kept: %s", name, err)
+		}
+	}
+	if _, err := srv.VolumeInspect("named"); err == nil {
+		t.Fatal("Expected the named volume to be removed")
+	}
+}
+
+func TestVolumesExportImport(t *testing.T) {
+	eng := NewTestEngine(t)
+	srv := mkServerFromEngine(eng, t)
+	runtime := mkRuntimeFromEngine(eng, t)
+	defer runtime.Nuke()
+
+	if _, err := srv.VolumeCreate("ro", ""); err != nil {
+		t.Fatal(err)
+	}
+	config, hostConfig, _, err := docker.ParseRun([]string{"-v", "/data", "-v", "ro:/ro:ro", unitTestImageID, "sh", "-c", "echo hello > /data/hello"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := createTestContainer(eng, config, t)
+	job := eng.Job("start", id)
+	if err := job.ImportEnv(hostConfig); err != nil {
+		t.Fatal(err)
+	}
+	if err := job.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := srv.ContainerWait(id); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := srv.ContainerVolumesExport(id, []string{"/nonexistent"}, ioutil.Discard); err == nil {
+		t.Fatal("Expected an error when exporting a path which is not a volume")
+	}
+	var backup bytes.Buffer
+	if err := srv.ContainerVolumesExport(id, nil, &backup); err != nil {
+		t.Fatal(err)
+	}
+
+	// Restore the volumes in a container which doesn't have them yet. The
+	// named volume has to be removed first, as volume names are unique.
+	if _, err := srv.ContainerDestroy(id, true, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := srv.VolumeDestroy("ro"); err != nil {
+		t.Fatal(err)
+	}
+	config, _, _, err = docker.ParseRun([]string{unitTestImageID, "true"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id = createTestContainer(eng, config, t)
+	if err := srv.ContainerVolumesImport(id, &backup, false); err != nil {
+		t.Fatal(err)
+	}
+
+	container := runtime.Get(id)
+	if rw, exists := container.VolumesRW["/data"]; !exists || !rw {
+		t.Fatalf("Expected /data to be restored read-write, got %v", container.VolumesRW)
+	}
+	if rw, exists := container.VolumesRW["/ro"]; !exists || rw {
+		t.Fatalf("Expected /ro to be restored read-only, got %v", container.VolumesRW)
+	}
+	if content := readFile(path.Join(container.Volumes["/data"], "hello"), t); content != "hello\n" {
+		t.Fatalf("Unexpected content of /data/hello: %q", content)
+	}
+	if volume, err := srv.VolumeInspect("ro"); err != nil {
+		t.Fatalf("Expected the named volume to be recreated: %s", err)
+	} else if volume.Path != container.Volumes["/ro"] {
+		t.Fatalf("Expected /ro to be the named volume %s, got %s", volume.Path, container.Volumes["/ro"])
+	}
+}
+
+func TestContainerSaveLoad(t *testing.T) {
+	eng := NewTestEngine(t)
+	srv := mkServerFromEngine(eng, t)
+	runtime := mkRuntimeFromEngine(eng, t)
+	defer runtime.Nuke()
+
+	config, hostConfig, _, err := docker.ParseRun([]string{"-name", "saved", "-v", "/data", unitTestImageID, "sh", "-c", "echo hello > /hello; echo world > /data/world"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := createNamedTestContainer(eng, config, t, "saved")
+	job := eng.Job("start", id)
+	if err := job.ImportEnv(hostConfig); err != nil {
+		t.Fatal(err)
+	}
+	if err := job.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := srv.ContainerWait(id); err != nil {
+		t.Fatal(err)
+	}
+
+	var saved bytes.Buffer
+	if err := srv.ContainerSave("saved", &saved); err != nil {
+		t.Fatal(err)
+	}
+	archive := saved.Bytes()
+
+	// The name of the saved container is taken
+	if _, err := srv.ContainerLoad("", bytes.NewReader(archive), false); err == nil {
+		t.Fatal("Expected an error when loading a container with a name in use")
+	}
+	loaded, err := srv.ContainerLoad("loaded", bytes.NewReader(archive), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.ID == id || loaded.Name != "/loaded" {
+		t.Fatalf("Expected a new container named /loaded, got %s (%s)", loaded.Name, loaded.ID)
+	}
+	if loaded.State.IsRunning() {
+		t.Fatal("Expected the loaded container to be stopped")
+	}
+	original := runtime.Get(id)
+	if loaded.Image != original.Image || strings.Join(loaded.Config.Cmd, " ") != strings.Join(original.Config.Cmd, " ") {
+		t.Fatalf("Expected the config of the saved container, got %v", loaded.Config)
+	}
+	if content := readFile(path.Join(loaded.RootfsPath(), "hello"), t); content != "hello\n" {
+		t.Fatalf("Unexpected content of /hello: %q", content)
+	}
+	if loaded.Volumes["/data"] == original.Volumes["/data"] || !loaded.VolumesRW["/data"] {
+		t.Fatalf("Expected a new read-write volume for /data, got %v", loaded.Volumes)
+	}
+	if content := readFile(path.Join(loaded.Volumes["/data"], "world"), t); content != "world\n" {
+		t.Fatalf("Unexpected content of /data/world: %q", content)
+	}
+}
+
 func TestCommit(t *testing.T) {
 	eng := NewTestEngine(t)
 	srv := mkServerFromEngine(eng, t)
@@ -204,7 +459,7 @@ func TestCreateStartRestartStopStartKillRm(t *testing.T) {
 	}
 
 	// FIXME: this failed once with a race condition ("Unable to remove filesystem for xxx: directory not empty")
-	if err := srv.ContainerDestroy(id, true, false); err != nil {
+	if _, err := srv.ContainerDestroy(id, true, false); err != nil {
 		t.Fatal(err)
 	}
 
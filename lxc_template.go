@@ -1,6 +1,7 @@
 package docker
 
 import (
+	"strings"
 	"text/template"
 )
 
@@ -77,6 +78,11 @@ lxc.cgroup.devices.allow = c 10:200 rwm
 
 # rtc
 #lxc.cgroup.devices.allow = c 254:0 rwm
+
+# devices requested with -device
+{{range $device := getDevices .}}
+lxc.cgroup.devices.allow = {{$device.Type}} {{$device.Major}}:{{$device.Minor}} {{$device.Permissions}}
+{{end}}
 {{end}}
 
 # standard mount point
@@ -108,19 +114,27 @@ lxc.mount.entry = {{$realPath}} {{$ROOTFS}}/{{$virtualPath}} none bind,{{ if ind
 {{end}}
 {{end}}
 
+{{with $tmpfs := (getHostConfig .).Tmpfs}}
+# in-memory mounts requested with -tmpfs
+{{range $path, $options := $tmpfs}}
+lxc.mount.entry = tmpfs {{$ROOTFS}}{{$path}} tmpfs nosuid,nodev{{if $options}},{{$options}}{{end}} 0 0
+{{end}}
+{{end}}
+
 {{if (getHostConfig .).Privileged}}
-# retain all capabilities; no lxc.cap.drop line
+# retain all capabilities unless explicitly dropped
 {{if (getCapabilities .).AppArmor}}
 lxc.aa_profile = unconfined
 {{else}}
 #lxc.aa_profile = unconfined
 {{end}}
-{{else}}
+{{end}}
+{{with $drop := getDroppedCapabilities .}}
 # drop linux capabilities (apply mainly to the user root in the container)
 #  (Note: 'lxc.cap.keep' is coming soon and should replace this under the
 #         security principle 'deny all unless explicitly permitted', see
 #         http://sourceforge.net/mailarchive/message.php?msg_id=31054627 )
-lxc.cap.drop = audit_control audit_write mac_admin mac_override mknod setpcap sys_admin sys_module sys_nice sys_pacct sys_rawio sys_resource sys_time sys_tty_config
+lxc.cap.drop = {{$drop}}
 {{end}}
 
 # limits
@@ -134,6 +148,15 @@ lxc.cgroup.memory.memsw.limit_in_bytes = {{$memSwap}}
 {{if .Config.CpuShares}}
 lxc.cgroup.cpu.shares = {{.Config.CpuShares}}
 {{end}}
+{{if .Config.CpusetCpus}}
+lxc.cgroup.cpuset.cpus = {{.Config.CpusetCpus}}
+{{end}}
+{{if .Config.CpusetMems}}
+lxc.cgroup.cpuset.mems = {{.Config.CpusetMems}}
+{{end}}
+{{if .Config.BlkioWeight}}
+lxc.cgroup.blkio.weight = {{.Config.BlkioWeight}}
+{{end}}
 
 {{if (getHostConfig .).LxcConf}}
 {{range $pair := (getHostConfig .).LxcConf}}
@@ -144,6 +167,25 @@ lxc.cgroup.cpu.shares = {{.Config.CpuShares}}
 
 var LxcTemplateCompiled *template.Template
 
+// All the linux capabilities known to lxc, in the order they are defined by the kernel
+var allCapabilities = []string{
+	"chown", "dac_override", "dac_read_search", "fowner", "fsetid", "kill",
+	"setgid", "setuid", "setpcap", "linux_immutable", "net_bind_service",
+	"net_broadcast", "net_admin", "net_raw", "ipc_lock", "ipc_owner",
+	"sys_module", "sys_rawio", "sys_chroot", "sys_ptrace", "sys_pacct",
+	"sys_admin", "sys_boot", "sys_nice", "sys_resource", "sys_time",
+	"sys_tty_config", "mknod", "lease", "audit_write", "audit_control",
+	"setfcap", "mac_override", "mac_admin", "syslog", "wake_alarm",
+	"block_suspend",
+}
+
+// Capabilities dropped from non-privileged containers
+var defaultDropCapabilities = []string{
+	"audit_control", "audit_write", "mac_admin", "mac_override", "mknod",
+	"setpcap", "sys_admin", "sys_module", "sys_nice", "sys_pacct",
+	"sys_rawio", "sys_resource", "sys_time", "sys_tty_config",
+}
+
 func getMemorySwap(config *Config) int64 {
 	// By default, MemorySwap is set to twice the size of RAM.
 	// If you want to omit MemorySwap, set it to `-1'.
@@ -161,12 +203,71 @@ func getCapabilities(container *Container) *Capabilities {
 	return container.runtime.capabilities
 }
 
+func getDevices(container *Container) []*Device {
+	return container.devices
+}
+
+// getDroppedCapabilities returns the space separated list of capabilities
+// for lxc to drop. When the container has ulimits, sys_resource is left to
+// dockerinit, which needs it to raise the hard limits.
+func getDroppedCapabilities(container *Container) string {
+	var out []string
+	for _, c := range droppedCapabilities(container) {
+		if c == "sys_resource" && len(container.ulimits()) > 0 {
+			continue
+		}
+		out = append(out, c)
+	}
+	return strings.Join(out, " ")
+}
+
+// droppedCapabilities returns the capabilities to drop, starting from the
+// default set (or none if privileged) and applying the CapAdd and CapDrop
+// lists of the host config.
+func droppedCapabilities(container *Container) []string {
+	hostConfig := container.hostConfig
+	drop := make(map[string]bool)
+	if !hostConfig.Privileged {
+		for _, c := range defaultDropCapabilities {
+			drop[c] = true
+		}
+	}
+	for _, c := range hostConfig.CapDrop {
+		if c == "all" {
+			for _, c := range allCapabilities {
+				drop[c] = true
+			}
+		}
+	}
+	for _, c := range hostConfig.CapAdd {
+		if c == "all" {
+			drop = make(map[string]bool)
+		}
+		delete(drop, c)
+	}
+	for _, c := range hostConfig.CapDrop {
+		if c != "all" {
+			drop[c] = true
+		}
+	}
+
+	var out []string
+	for _, c := range allCapabilities {
+		if drop[c] {
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
 func init() {
 	var err error
 	funcMap := template.FuncMap{
-		"getMemorySwap":   getMemorySwap,
-		"getHostConfig":   getHostConfig,
-		"getCapabilities": getCapabilities,
+		"getMemorySwap":          getMemorySwap,
+		"getHostConfig":          getHostConfig,
+		"getCapabilities":        getCapabilities,
+		"getDroppedCapabilities": getDroppedCapabilities,
+		"getDevices":             getDevices,
 	}
 	LxcTemplateCompiled, err = template.New("lxc").Funcs(funcMap).Parse(LxcTemplate)
 	if err != nil {
@@ -3,6 +3,7 @@ package docker
 import (
 	"bufio"
 	"fmt"
+	"github.com/dotcloud/docker/utils"
 	"io/ioutil"
 	"math/rand"
 	"os"
@@ -32,6 +33,9 @@ func TestLXCConfig(t *testing.T) {
 			Hostname:        "foobar",
 			Memory:          int64(mem),
 			CpuShares:       int64(cpu),
+			CpusetCpus:      "0-1",
+			CpusetMems:      "0",
+			BlkioWeight:     500,
 			NetworkDisabled: true,
 		},
 		hostConfig: &HostConfig{
@@ -46,6 +50,9 @@ func TestLXCConfig(t *testing.T) {
 		fmt.Sprintf("lxc.cgroup.memory.limit_in_bytes = %d", mem))
 	grepFile(t, container.lxcConfigPath(),
 		fmt.Sprintf("lxc.cgroup.memory.memsw.limit_in_bytes = %d", mem*2))
+	grepFile(t, container.lxcConfigPath(), "lxc.cgroup.cpuset.cpus = 0-1")
+	grepFile(t, container.lxcConfigPath(), "lxc.cgroup.cpuset.mems = 0")
+	grepFile(t, container.lxcConfigPath(), "lxc.cgroup.blkio.weight = 500")
 }
 
 func TestCustomLxcConfig(t *testing.T) {
@@ -81,6 +88,121 @@ func TestCustomLxcConfig(t *testing.T) {
 	grepFile(t, container.lxcConfigPath(), "lxc.cgroup.cpuset.cpus = 0,1")
 }
 
+func TestLXCConfigDevices(t *testing.T) {
+	root, err := ioutil.TempDir("", "TestLXCConfigDevices")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	container := &Container{
+		root: root,
+		Config: &Config{
+			Hostname:        "foobar",
+			NetworkDisabled: true,
+		},
+		hostConfig: &HostConfig{},
+		devices: []*Device{
+			{Type: "c", Major: 10, Minor: 229, Permissions: "rwm", PathInContainer: "/dev/fuse"},
+		},
+	}
+	if err := container.generateLXCConfig(); err != nil {
+		t.Fatal(err)
+	}
+	grepFile(t, container.lxcConfigPath(), "lxc.cgroup.devices.allow = c 10:229 rwm")
+}
+
+func TestLXCConfigTmpfs(t *testing.T) {
+	root, err := ioutil.TempDir("", "TestLXCConfigTmpfs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	container := &Container{
+		root:   root,
+		rootfs: "/rootfs",
+		Config: &Config{
+			Hostname:        "foobar",
+			NetworkDisabled: true,
+		},
+		hostConfig: &HostConfig{
+			Tmpfs: map[string]string{"/run": "size=64m,mode=755", "/tmp": ""},
+		},
+	}
+	if err := container.generateLXCConfig(); err != nil {
+		t.Fatal(err)
+	}
+	grepFile(t, container.lxcConfigPath(), "lxc.mount.entry = tmpfs /rootfs/run tmpfs nosuid,nodev,size=64m,mode=755 0 0")
+	grepFile(t, container.lxcConfigPath(), "lxc.mount.entry = tmpfs /rootfs/tmp tmpfs nosuid,nodev 0 0")
+}
+
+func TestLXCConfigCapabilities(t *testing.T) {
+	root, err := ioutil.TempDir("", "TestLXCConfigCapabilities")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	container := &Container{
+		root: root,
+		Config: &Config{
+			Hostname:        "foobar",
+			NetworkDisabled: true,
+		},
+		hostConfig: &HostConfig{
+			Privileged: false,
+			CapAdd:     []string{"sys_admin", "mknod"},
+			CapDrop:    []string{"net_raw"},
+		},
+	}
+	if err := container.generateLXCConfig(); err != nil {
+		t.Fatal(err)
+	}
+	grepFile(t, container.lxcConfigPath(), "lxc.cap.drop = setpcap net_raw sys_module sys_rawio sys_pacct sys_nice sys_resource sys_time sys_tty_config audit_write audit_control mac_override mac_admin")
+}
+
+func TestLXCConfigUlimits(t *testing.T) {
+	root, err := ioutil.TempDir("", "TestLXCConfigUlimits")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	container := &Container{
+		root: root,
+		Config: &Config{
+			Hostname:        "foobar",
+			NetworkDisabled: true,
+		},
+		hostConfig: &HostConfig{
+			Ulimits: []*utils.Ulimit{{Name: "nofile", Soft: 1024, Hard: -1}},
+		},
+	}
+	if err := container.generateLXCConfig(); err != nil {
+		t.Fatal(err)
+	}
+	// dockerinit needs sys_resource to raise the hard limit, and drops it itself
+	grepFile(t, container.lxcConfigPath(), "lxc.cap.drop = setpcap sys_module sys_rawio sys_pacct sys_admin sys_nice sys_time sys_tty_config mknod audit_write audit_control mac_override mac_admin")
+}
+
+func TestGetDroppedCapabilities(t *testing.T) {
+	container := &Container{hostConfig: &HostConfig{Privileged: true}}
+	if drop := getDroppedCapabilities(container); drop != "" {
+		t.Fatalf("Expected no dropped capabilities for a privileged container, got %s", drop)
+	}
+
+	container.hostConfig.CapDrop = []string{"mknod"}
+	if drop := getDroppedCapabilities(container); drop != "mknod" {
+		t.Fatalf("Expected mknod, got %s", drop)
+	}
+
+	container.hostConfig = &HostConfig{CapDrop: []string{"all"}, CapAdd: []string{"chown", "kill"}}
+	drop := getDroppedCapabilities(container)
+	if strings.Contains(drop, "chown") || strings.Contains(drop, "kill") {
+		t.Fatalf("Expected chown and kill to be kept, got %s", drop)
+	}
+	if !strings.Contains(drop, "net_admin") {
+		t.Fatalf("Expected net_admin to be dropped, got %s", drop)
+	}
+}
+
 func grepFile(t *testing.T, path string, pattern string) {
 	f, err := os.Open(path)
 	if err != nil {
@@ -0,0 +1,11 @@
+package docker
+
+import "errors"
+
+func mountReadonlyRootfs(rootfs string) error {
+	return errors.New("read-only rootfs is not implemented on darwin")
+}
+
+func unmountReadonlyRootfs(rootfs string) error {
+	return nil
+}
@@ -0,0 +1,40 @@
+package docker
+
+import (
+	"os"
+	"path"
+	"syscall"
+)
+
+// mountReadonlyRootfs stacks a read-only bind mount on top of the
+// container's rootfs, so that the mounts lxc sets up inside it (volumes,
+// /etc/hosts, /etc/hostname, resolv.conf) keep their own mode.
+func mountReadonlyRootfs(rootfs string) error {
+	// lxc can't create its pivot directory once the rootfs is read-only.
+	// The init layer has it, except for the containers created before.
+	if err := os.MkdirAll(path.Join(rootfs, "lxc_putold"), 0755); err != nil {
+		return err
+	}
+	if err := syscall.Mount(rootfs, rootfs, "", syscall.MS_BIND, ""); err != nil {
+		return err
+	}
+	if err := syscall.Mount(rootfs, rootfs, "", syscall.MS_BIND|syscall.MS_REMOUNT|syscall.MS_RDONLY, ""); err != nil {
+		syscall.Unmount(rootfs, 0)
+		return err
+	}
+	return nil
+}
+
+// unmountReadonlyRootfs removes the read-only bind mount set up by
+// mountReadonlyRootfs, if it is still there.
+func unmountReadonlyRootfs(rootfs string) error {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(rootfs, &stat); err != nil {
+		return err
+	}
+	// ST_RDONLY
+	if stat.Flags&1 == 0 {
+		return nil
+	}
+	return syscall.Unmount(rootfs, 0)
+}
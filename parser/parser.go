@@ -0,0 +1,240 @@
+package parser
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+)
+
+// Node is an instruction of a Dockerfile
+type Node struct {
+	Line        int    // Line of the instruction, the first one if it spans several
+	Instruction string // Name of the instruction, in upper case
+	Args        string // Arguments, with the line continuations joined
+}
+
+func (node *Node) String() string {
+	return node.Instruction + " " + node.Args
+}
+
+// Error is a syntax error in a Dockerfile
+type Error struct {
+	Line int
+	Msg  string
+}
+
+func (err *Error) Error() string {
+	return fmt.Sprintf("Dockerfile line %d: %s", err.Line, err.Msg)
+}
+
+// Instructions are the names of the instructions of a Dockerfile
+var Instructions = []string{
+	"ADD", "ARG", "CMD", "COPY", "ENTRYPOINT", "ENV", "EXPOSE", "FROM",
+	"HEALTHCHECK", "INSERT", "MAINTAINER", "ONBUILD", "RUN", "STOPSIGNAL",
+	"USER", "VOLUME", "WORKDIR",
+}
+
+func isInstruction(name string) bool {
+	for _, instruction := range Instructions {
+		if instruction == name {
+			return true
+		}
+	}
+	return false
+}
+
+// The instructions whose arguments are words, which may be quoted
+var wordInstructions = map[string]bool{"ADD": true, "EXPOSE": true, "FROM": true}
+
+// The instructions whose argument is a command, as a JSON array or a string
+var commandInstructions = map[string]bool{"CMD": true, "ENTRYPOINT": true, "RUN": true}
+
+// A backslash at the end of a line continues the instruction on the next
+// line, unless it is itself escaped.
+var lineContinuation = regexp.MustCompile(`(^|[^\\])(\\\\)*\\[ \t\r]*$`)
+
+// Parse reads the instructions of a Dockerfile. Empty lines and comments
+// are skipped, and an unknown or malformed instruction is an error giving
+// its line.
+func Parse(r io.Reader) ([]*Node, error) {
+	var (
+		nodes   []*Node
+		current string
+		start   int
+		lineN   int
+	)
+	// Read line by line rather than with a bufio.Scanner, which has a limit
+	// on the length of a line
+	reader := bufio.NewReader(r)
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		if err == io.EOF && line == "" {
+			break
+		}
+		lineN += 1
+		line = strings.TrimSuffix(strings.TrimSuffix(line, "\n"), "\r")
+		// Skip comments and empty lines, even in the middle of an instruction
+		if trimmed := strings.TrimSpace(line); len(trimmed) == 0 || trimmed[0] == '#' {
+			continue
+		}
+		if current == "" {
+			start = lineN
+		}
+		if lineContinuation.MatchString(line) {
+			// Only drop the backslash, the whitespace around it separates words
+			current += strings.TrimSuffix(strings.TrimRight(line, " \t\r"), "\\")
+			continue
+		}
+		node, err := ParseInstruction(start, current+line)
+		if err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, node)
+		current = ""
+	}
+	// A continuation on the last line continues nothing
+	if current != "" {
+		node, err := ParseInstruction(start, current)
+		if err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, node)
+	}
+	return nodes, nil
+}
+
+// ParseInstruction parses a single instruction, found at the given line
+func ParseInstruction(line int, text string) (*Node, error) {
+	text = strings.TrimSpace(text)
+	node := &Node{Line: line, Instruction: text}
+	if i := strings.IndexAny(text, " \t"); i >= 0 {
+		node.Instruction, node.Args = text[:i], strings.TrimSpace(text[i+1:])
+	}
+	node.Instruction = strings.ToUpper(node.Instruction)
+	if !isInstruction(node.Instruction) {
+		return nil, &Error{line, fmt.Sprintf("unknown instruction %s", node.Instruction)}
+	}
+	if node.Args == "" {
+		return nil, &Error{line, fmt.Sprintf("%s requires arguments", node.Instruction)}
+	}
+
+	switch {
+	case wordInstructions[node.Instruction]:
+		if _, err := SplitWords(node.Args); err != nil {
+			return nil, &Error{line, fmt.Sprintf("%s %s", node.Instruction, err)}
+		}
+	case commandInstructions[node.Instruction]:
+		if _, _, err := ParseCommand(node.Instruction, node.Args); err != nil {
+			return nil, &Error{line, fmt.Sprintf("%s %s", node.Instruction, err)}
+		}
+	case node.Instruction == "ONBUILD":
+		if _, err := ParseTrigger(line, node.Args); err != nil {
+			return nil, err
+		}
+	}
+	return node, nil
+}
+
+// ParseTrigger parses the instruction of an ONBUILD trigger, which can't
+// be ONBUILD, FROM or MAINTAINER.
+func ParseTrigger(line int, text string) (*Node, error) {
+	trigger, err := ParseInstruction(line, text)
+	if err != nil {
+		return nil, err
+	}
+	switch trigger.Instruction {
+	case "ONBUILD", "FROM", "MAINTAINER":
+		return nil, &Error{line, fmt.Sprintf("%s isn't allowed as an ONBUILD trigger", trigger.Instruction)}
+	}
+	return trigger, nil
+}
+
+// SplitWords splits arguments into words separated by whitespace, as a
+// shell does: single quotes keep everything they enclose as is, double
+// quotes and backslashes escape whitespace.
+func SplitWords(args string) ([]string, error) {
+	var (
+		words   []string
+		word    []rune
+		inWord  bool
+		quote   rune
+		escaped bool
+	)
+	for _, c := range args {
+		switch {
+		case escaped:
+			word = append(word, c)
+			escaped = false
+		case quote == '\'':
+			if c == '\'' {
+				quote = 0
+			} else {
+				word = append(word, c)
+			}
+		case c == '\\' && (quote == 0 || quote == '"'):
+			escaped, inWord = true, true
+		case quote == '"':
+			if c == '"' {
+				quote = 0
+			} else {
+				word = append(word, c)
+			}
+		case c == '\'' || c == '"':
+			quote, inWord = c, true
+		case c == ' ' || c == '\t':
+			if inWord {
+				words = append(words, string(word))
+				word, inWord = nil, false
+			}
+		default:
+			word = append(word, c)
+			inWord = true
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("has an unterminated quote: %s", args)
+	}
+	if escaped {
+		return nil, fmt.Errorf("ends with an unterminated escape: %s", args)
+	}
+	if inWord {
+		words = append(words, string(word))
+	}
+	return words, nil
+}
+
+// ParseCommand parses the command of RUN, CMD, ENTRYPOINT or HEALTHCHECK
+// as ParseJSON does. An empty JSON array resets the command of CMD and
+// ENTRYPOINT, but RUN and HEALTHCHECK need a command.
+func ParseCommand(instruction, args string) ([]string, bool, error) {
+	cmd, isJSON, err := ParseJSON(args)
+	if err == nil && isJSON && len(cmd) == 0 && instruction != "CMD" && instruction != "ENTRYPOINT" {
+		return nil, true, fmt.Errorf("requires a command, got an empty JSON array")
+	}
+	return cmd, isJSON, err
+}
+
+// ParseJSON parses a command given as arguments of an instruction. It
+// returns the command if it is a JSON array of strings, to be run as is,
+// and false if it is a plain string, to be run with a shell.
+func ParseJSON(args string) ([]string, bool, error) {
+	var cmd []interface{}
+	if err := json.Unmarshal([]byte(args), &cmd); err != nil {
+		return nil, false, nil
+	}
+	result := make([]string, len(cmd))
+	for i, arg := range cmd {
+		str, ok := arg.(string)
+		if !ok {
+			return nil, true, fmt.Errorf("requires a JSON array of strings, got %s", args)
+		}
+		result[i] = str
+	}
+	return result, true, nil
+}
@@ -0,0 +1,110 @@
+package parser
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	dockerfile := `# A comment
+from	busybox
+
+run echo "hello" \
+    && echo \
+# A comment in the middle of an instruction
+    "world"
+run echo \\
+ONBUILD add . /app
+cmd ["/bin/echo", "hello"]
+entrypoint []
+`
+	nodes, err := Parse(strings.NewReader(dockerfile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []Node{
+		{2, "FROM", "busybox"},
+		{4, "RUN", `echo "hello"     && echo     "world"`},
+		{8, "RUN", `echo \\`},
+		{9, "ONBUILD", "add . /app"},
+		{10, "CMD", `["/bin/echo", "hello"]`},
+		{11, "ENTRYPOINT", "[]"},
+	}
+	if len(nodes) != len(expected) {
+		t.Fatalf("Expected %d instructions, got %d", len(expected), len(nodes))
+	}
+	for i, node := range nodes {
+		if *node != expected[i] {
+			t.Fatalf("Expected %#v, got %#v", expected[i], *node)
+		}
+	}
+}
+
+func TestParseLongLine(t *testing.T) {
+	// Longer than the 64KB limit of a bufio.Scanner
+	args := "echo " + strings.Repeat("a", 100*1024)
+	nodes, err := Parse(strings.NewReader("from busybox\r\nrun " + args))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(nodes) != 2 || nodes[0].Args != "busybox" || nodes[1].Args != args {
+		t.Fatalf("Expected the long RUN line to be parsed, got %d instructions", len(nodes))
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for dockerfile, expected := range map[string]string{
+		"from busybox\n\nfoo bar\n":                "Dockerfile line 3: unknown instruction FOO",
+		"from busybox\nrun\n":                      "Dockerfile line 2: RUN requires arguments",
+		"from busybox\nrun \\\n  []\n":             "Dockerfile line 2: RUN requires a command, got an empty JSON array",
+		"from busybox\ncmd [\"echo\", 1]\n":        `Dockerfile line 2: CMD requires a JSON array of strings, got ["echo", 1]`,
+		"from busybox\nadd \"foo /bar\n":           `Dockerfile line 2: ADD has an unterminated quote: "foo /bar`,
+		"from busybox\nonbuild from busybox\n":     "Dockerfile line 2: FROM isn't allowed as an ONBUILD trigger",
+		"from busybox\nonbuild bar baz\n":          "Dockerfile line 2: unknown instruction BAR",
+		"from busybox\n# comment\nexpose 80\nhi\n": "Dockerfile line 4: unknown instruction HI",
+	} {
+		if _, err := Parse(strings.NewReader(dockerfile)); err == nil || err.Error() != expected {
+			t.Errorf("Expected the error %q for %q, got %v", expected, dockerfile, err)
+		}
+	}
+}
+
+func TestParseTrigger(t *testing.T) {
+	node, err := ParseTrigger(3, "run make")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *node != (Node{3, "RUN", "make"}) {
+		t.Fatalf("Unexpected trigger %#v", *node)
+	}
+	// Triggers stored in an image are checked when they run, too
+	for _, trigger := range []string{"FROM busybox", "ONBUILD RUN make", "MAINTAINER me", "FOO bar"} {
+		if _, err := ParseTrigger(3, trigger); err == nil {
+			t.Errorf("Expected %q to be rejected", trigger)
+		}
+	}
+}
+
+func TestSplitWords(t *testing.T) {
+	for args, expected := range map[string][]string{
+		"foo  bar":                  {"foo", "bar"},
+		`"my file" /dest`:           {"my file", "/dest"},
+		`'it''s' "a \"b\""`:         {"its", `a "b"`},
+		`my\ file '\n'`:             {"my file", `\n`},
+		"--from=builder\t/src /dst": {"--from=builder", "/src", "/dst"},
+		`""`:                        {""},
+	} {
+		words, err := SplitWords(args)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.Join(words, "|") != strings.Join(expected, "|") || len(words) != len(expected) {
+			t.Errorf("Expected %q to be split as %q, got %q", args, expected, words)
+		}
+	}
+	for _, args := range []string{`"foo`, `'foo`, `foo\`} {
+		if _, err := SplitWords(args); err == nil {
+			t.Errorf("Expected %q to be rejected", args)
+		}
+	}
+}
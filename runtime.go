@@ -32,6 +32,8 @@ var defaultDns = []string{"8.8.8.8", "8.8.4.4"}
 type Capabilities struct {
 	MemoryLimit            bool
 	SwapLimit              bool
+	CpusetLimit            bool
+	BlkioWeight            bool
 	IPv4ForwardingDisabled bool
 	AppArmor               bool
 }
@@ -46,6 +48,7 @@ type Runtime struct {
 	idIndex        *utils.TruncIndex
 	capabilities   *Capabilities
 	volumes        *Graph
+	volumeStore    *VolumeStore
 	srv            *Server
 	config         *DaemonConfig
 	containerGraph *graphdb.Database
@@ -183,7 +186,7 @@ func (runtime *Runtime) Register(container *Container) error {
 
 			container.waitLock = make(chan struct{})
 
-			go container.monitor()
+			go container.monitor(container.startHealthMonitor())
 		}
 	}
 	return nil
@@ -340,6 +343,31 @@ func (runtime *Runtime) UpdateCapabilities(quiet bool) {
 		}
 	}
 
+	if cgroupCpusetMountpoint, err := utils.FindCgroupMountpoint("cpuset"); err != nil {
+		if !quiet {
+			log.Printf("WARNING: %s\n", err)
+		}
+	} else {
+		_, err1 := ioutil.ReadFile(path.Join(cgroupCpusetMountpoint, "cpuset.cpus"))
+		_, err2 := ioutil.ReadFile(path.Join(cgroupCpusetMountpoint, "cpuset.mems"))
+		runtime.capabilities.CpusetLimit = err1 == nil && err2 == nil
+		if !runtime.capabilities.CpusetLimit && !quiet {
+			log.Printf("WARNING: Your kernel does not support cgroup cpuset.")
+		}
+	}
+
+	if cgroupBlkioMountpoint, err := utils.FindCgroupMountpoint("blkio"); err != nil {
+		if !quiet {
+			log.Printf("WARNING: %s\n", err)
+		}
+	} else {
+		_, err := ioutil.ReadFile(path.Join(cgroupBlkioMountpoint, "blkio.weight"))
+		runtime.capabilities.BlkioWeight = err == nil
+		if !runtime.capabilities.BlkioWeight && !quiet {
+			log.Printf("WARNING: Your kernel does not support cgroup blkio weight.")
+		}
+	}
+
 	content, err3 := ioutil.ReadFile("/proc/sys/net/ipv4/ip_forward")
 	runtime.capabilities.IPv4ForwardingDisabled = err3 != nil || len(content) == 0 || content[0] != '1'
 	if runtime.capabilities.IPv4ForwardingDisabled && !quiet {
@@ -668,6 +696,10 @@ func NewRuntimeFromDirectory(config *DaemonConfig) (*Runtime, error) {
 	if err != nil {
 		return nil, err
 	}
+	volumeStore, err := NewVolumeStore(path.Join(config.Root, "volumes.json"), volumes)
+	if err != nil {
+		return nil, fmt.Errorf("Couldn't create Volume store: %s", err)
+	}
 	repositories, err := NewTagStore(path.Join(config.Root, "repositories-"+driver.String()), g)
 	if err != nil {
 		return nil, fmt.Errorf("Couldn't create Tag store: %s", err)
@@ -727,6 +759,7 @@ func NewRuntimeFromDirectory(config *DaemonConfig) (*Runtime, error) {
 		idIndex:        utils.NewTruncIndex(),
 		capabilities:   &Capabilities{},
 		volumes:        volumes,
+		volumeStore:    volumeStore,
 		config:         config,
 		containerGraph: graph,
 		driver:         driver,
@@ -779,7 +812,17 @@ func (runtime *Runtime) Unmount(container *Container) error {
 	return nil
 }
 
+// Changes returns the changes made to the container's filesystem,
+// leaving out those made under its tmpfs mounts and its device nodes.
 func (runtime *Runtime) Changes(container *Container) ([]archive.Change, error) {
+	changes, err := runtime.driverChanges(container)
+	if err != nil {
+		return nil, err
+	}
+	return excludeChanges(changes, append(container.tmpfsPaths(), container.devicePaths()...)), nil
+}
+
+func (runtime *Runtime) driverChanges(container *Container) ([]archive.Change, error) {
 	if differ, ok := runtime.driver.(graphdriver.Differ); ok {
 		return differ.Changes(container.ID)
 	}
@@ -795,7 +838,8 @@ func (runtime *Runtime) Changes(container *Container) ([]archive.Change, error)
 }
 
 func (runtime *Runtime) Diff(container *Container) (archive.Archive, error) {
-	if differ, ok := runtime.driver.(graphdriver.Differ); ok {
+	// The driver's own diff can't leave out the tmpfs mounts and devices
+	if differ, ok := runtime.driver.(graphdriver.Differ); ok && len(container.tmpfsPaths())+len(container.devicePaths()) == 0 {
 		return differ.Diff(container.ID)
 	}
 
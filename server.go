@@ -1,6 +1,7 @@
 package docker
 
 import (
+	"archive/tar"
 	"bufio"
 	"encoding/json"
 	"errors"
@@ -20,8 +21,8 @@ import (
 	"os/exec"
 	"os/signal"
 	"path"
-	"path/filepath"
 	"runtime"
+	"sort"
 	"strings"
 	"sync"
 	"syscall"
@@ -200,6 +201,257 @@ func (srv *Server) ContainerExport(name string, out io.Writer) error {
 	return fmt.Errorf("No such container: %s", name)
 }
 
+// ContainerVolumesExport writes a tar archive of the volumes of a container
+// mounted at the given paths, or of all of them if there are none.
+func (srv *Server) ContainerVolumesExport(name string, paths []string, out io.Writer) error {
+	container := srv.runtime.Get(name)
+	if container == nil {
+		return fmt.Errorf("No such container: %s", name)
+	}
+	tw := tar.NewWriter(out)
+	if err := container.exportVolumes(tw, "", paths); err != nil {
+		return err
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	srv.LogEvent("volume_export", container.ID, srv.runtime.repositories.ImageName(container.Image))
+	return nil
+}
+
+// ContainerVolumesImport restores the volumes of an archive made by
+// ContainerVolumesExport into a stopped container, creating the missing
+// ones with the driver recorded in the archive if keepDrivers is set.
+func (srv *Server) ContainerVolumesImport(name string, in io.Reader, keepDrivers bool) error {
+	container := srv.runtime.Get(name)
+	if container == nil {
+		return fmt.Errorf("No such container: %s", name)
+	}
+	if err := container.importVolumes(in, keepDrivers); err != nil {
+		return err
+	}
+	srv.LogEvent("volume_import", container.ID, srv.runtime.repositories.ImageName(container.Image))
+	return nil
+}
+
+// ContainerSave writes a tar archive of a container holding its config
+// (config.json), its host config and links (hostconfig.json), the changes
+// to its filesystem (layer/) and its volumes (volumes/), from which
+// ContainerLoad recreates it, eg. on another host.
+func (srv *Server) ContainerSave(name string, out io.Writer) error {
+	container := srv.runtime.Get(name)
+	if container == nil {
+		return fmt.Errorf("No such container: %s", name)
+	}
+	configJson, err := json.Marshal(container)
+	if err != nil {
+		return err
+	}
+
+	// The links are only kept in the links graph once registered
+	hostConfig := HostConfig{}
+	if container.hostConfig != nil {
+		hostConfig = *container.hostConfig
+	}
+	hostConfig.Links = nil
+	children, err := srv.runtime.Children(container.Name)
+	if err != nil {
+		return err
+	}
+	for fullName, child := range children {
+		hostConfig.Links = append(hostConfig.Links, fmt.Sprintf("%s:%s", strings.TrimPrefix(child.Name, "/"), path.Base(fullName)))
+	}
+	sort.Strings(hostConfig.Links)
+	hostConfigJson, err := json.Marshal(hostConfig)
+	if err != nil {
+		return err
+	}
+
+	// Only save the volumes of the container itself: bind mounts from the
+	// host and volumes from other containers are mounted again on start.
+	ownVolumes := make(map[string]bool)
+	for volPath := range container.Config.Volumes {
+		ownVolumes[path.Clean(volPath)] = true
+	}
+	var volPaths []string
+	for volPath := range container.Volumes {
+		if ownVolumes[volPath] && container.volume(volPath) != nil {
+			volPaths = append(volPaths, volPath)
+		}
+	}
+	sort.Strings(volPaths)
+
+	// The config comes first, ContainerLoad creates the container from it
+	// before reading the rest
+	tw := tar.NewWriter(out)
+	if err := writeTarFile(tw, "config.json", configJson); err != nil {
+		return err
+	}
+	if err := writeTarFile(tw, "hostconfig.json", hostConfigJson); err != nil {
+		return err
+	}
+	rw, err := container.ExportRw()
+	if err != nil {
+		return err
+	}
+	if err := copyTarEntries(tw, "layer", rw); err != nil {
+		return err
+	}
+	if len(volPaths) > 0 {
+		if err := container.exportVolumes(tw, "volumes", volPaths); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	srv.LogEvent("save", container.ID, srv.runtime.repositories.ImageName(container.Image))
+	return nil
+}
+
+// ContainerLoad creates a stopped container from an archive made by
+// ContainerSave, named after the saved container unless a name is given.
+// Its image and the containers it links to must exist. Its volumes are
+// created with the driver recorded in the archive if keepDrivers is set.
+func (srv *Server) ContainerLoad(name string, in io.Reader, keepDrivers bool) (*Container, error) {
+	var (
+		saved      Container
+		hostConfig *HostConfig
+	)
+	tr := tar.NewReader(in)
+	hdr, err := tr.Next()
+	for ; err == nil; hdr, err = tr.Next() {
+		if hdr.Name == "config.json" {
+			err = json.NewDecoder(tr).Decode(&saved)
+		} else if hdr.Name == "hostconfig.json" {
+			hostConfig = &HostConfig{}
+			err = json.NewDecoder(tr).Decode(hostConfig)
+		} else {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Invalid container archive: %s", err)
+		}
+	}
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	if saved.Config == nil || hostConfig == nil {
+		return nil, fmt.Errorf("Invalid container archive: missing config")
+	}
+
+	// The archive may come from anywhere, trust its host config no more
+	// than the one given on start
+	if err := validateHostConfig(saved.Config, hostConfig); err != nil {
+		return nil, err
+	}
+	links := make(map[string]*Container)
+	for _, l := range hostConfig.Links {
+		parts, err := parseLink(l)
+		if err != nil {
+			return nil, err
+		}
+		child, err := srv.runtime.GetByName(parts["name"])
+		if err != nil || child == nil {
+			return nil, fmt.Errorf("No such container: %s, linked as %s. Load it first", parts["name"], parts["alias"])
+		}
+		links[parts["alias"]] = child
+	}
+	hostConfig.Links = nil
+
+	if name == "" {
+		name = saved.Name
+	}
+	// Create the container from the exact same image, whatever the
+	// image name points to on this host.
+	config := saved.Config
+	imageName := config.Image
+	config.Image = saved.Image
+	container, _, err := srv.runtime.Create(config, name)
+	if err != nil {
+		return nil, err
+	}
+	container.Config.Image = imageName
+	container.hostConfig = hostConfig
+
+	if err := container.EnsureMounted(); err != nil {
+		srv.destroyLoadedContainer(container, nil)
+		return nil, err
+	}
+	defer container.Unmount()
+	volumes, err := container.newVolumeImporter(keepDrivers)
+	if err != nil {
+		srv.destroyLoadedContainer(container, nil)
+		return nil, err
+	}
+	if err := srv.loadContainerContent(container, volumes, tr, hdr); err != nil {
+		srv.destroyLoadedContainer(container, volumes)
+		return nil, err
+	}
+	for alias, child := range links {
+		if err := srv.runtime.RegisterLink(container, child, alias); err != nil {
+			srv.destroyLoadedContainer(container, volumes)
+			return nil, err
+		}
+	}
+	srv.LogEvent("load", container.ID, srv.runtime.repositories.ImageName(container.Image))
+	return container, nil
+}
+
+// loadContainerContent unpacks the changes to the filesystem and the
+// volumes of a saved container, starting with the entry hdr of tr.
+func (srv *Server) loadContainerContent(container *Container, volumes *volumeImporter, tr *tar.Reader, hdr *tar.Header) error {
+	layer := newUntarStream(func(r io.Reader) error {
+		return archive.ApplyLayer(container.RootfsPath(), r)
+	})
+	closeLayer := func() error {
+		if layer == nil {
+			return nil
+		}
+		err := layer.close()
+		layer = nil
+		return err
+	}
+	defer closeLayer()
+
+	var err error
+	for ; err == nil && hdr != nil; hdr, err = tr.Next() {
+		name := path.Clean(hdr.Name)
+		switch {
+		case layer != nil && trimTarEntry(hdr, "layer"):
+			err = layer.add(hdr, tr)
+		case strings.HasPrefix(name, "volumes/"):
+			// The volumes come last and are mounted in the container's
+			// filesystem, which must be complete first
+			if err = closeLayer(); err == nil {
+				hdr.Name = strings.TrimPrefix(name, "volumes/")
+				err = volumes.add(hdr, tr)
+			}
+		case name == "volumes" && hdr.Typeflag == tar.TypeDir:
+		default:
+			err = fmt.Errorf("Invalid container archive: unexpected entry %s", hdr.Name)
+		}
+	}
+	if err != nil && err != io.EOF {
+		return err
+	}
+	if err := closeLayer(); err != nil {
+		return err
+	}
+	return volumes.close()
+}
+
+// destroyLoadedContainer removes a container ContainerLoad failed to load,
+// along with the volumes created for it.
+func (srv *Server) destroyLoadedContainer(container *Container, volumes *volumeImporter) {
+	if volumes != nil {
+		volumes.abort()
+	}
+	if err := srv.runtime.Destroy(container); err != nil {
+		utils.Errorf("Unable to remove the partially loaded container %s: %s", container.ID, err)
+	}
+}
+
 // ImageExport exports all images with the given tag. All versions
 // containing the same tag are exported. The resulting output is an
 // uncompressed tar ball.
@@ -600,6 +852,8 @@ func (srv *Server) DockerInfo() *APIInfo {
 		DriverStatus:       srv.runtime.driver.Status(),
 		MemoryLimit:        srv.runtime.capabilities.MemoryLimit,
 		SwapLimit:          srv.runtime.capabilities.SwapLimit,
+		CpusetLimit:        srv.runtime.capabilities.CpusetLimit,
+		BlkioWeight:        srv.runtime.capabilities.BlkioWeight,
 		IPv4Forwarding:     !srv.runtime.capabilities.IPv4ForwardingDisabled,
 		Debug:              os.Getenv("DEBUG") != "",
 		NFd:                utils.GetTotalUsedFds(),
@@ -1287,6 +1541,31 @@ func (srv *Server) ContainerCreate(job *engine.Job) string {
 	if config.Memory > 0 && !srv.runtime.capabilities.SwapLimit {
 		config.MemorySwap = -1
 	}
+	if config.CpusetCpus != "" {
+		if err := validateCpuset(config.CpusetCpus); err != nil {
+			return err.Error()
+		}
+	}
+	if config.CpusetMems != "" {
+		if err := validateCpuset(config.CpusetMems); err != nil {
+			return err.Error()
+		}
+	}
+	if err := validateBlkioWeight(config.BlkioWeight); err != nil {
+		return err.Error()
+	}
+	if config.StopSignal != "" {
+		if _, err := utils.ParseSignal(config.StopSignal); err != nil {
+			return err.Error()
+		}
+	}
+	if (config.CpusetCpus != "" || config.CpusetMems != "") && !srv.runtime.capabilities.CpusetLimit {
+		config.CpusetCpus = ""
+		config.CpusetMems = ""
+	}
+	if config.BlkioWeight > 0 && !srv.runtime.capabilities.BlkioWeight {
+		config.BlkioWeight = 0
+	}
 	container, buildWarnings, err := srv.runtime.Create(&config, name)
 	if err != nil {
 		if srv.runtime.graph.IsNotExist(err) {
@@ -1323,24 +1602,26 @@ func (srv *Server) ContainerRestart(name string, t int) error {
 	return nil
 }
 
-func (srv *Server) ContainerDestroy(name string, removeVolume, removeLink bool) error {
+// ContainerDestroy removes a container. It returns warnings about the
+// volumes of the container which are kept.
+func (srv *Server) ContainerDestroy(name string, removeVolume, removeLink bool) ([]string, error) {
 	container := srv.runtime.Get(name)
 
 	if removeLink {
 		if container == nil {
-			return fmt.Errorf("No such link: %s", name)
+			return nil, fmt.Errorf("No such link: %s", name)
 		}
 		name, err := srv.runtime.getFullName(name)
 		if err != nil {
-			return err
+			return nil, err
 		}
 		parent, n := path.Split(name)
 		if parent == "/" {
-			return fmt.Errorf("Conflict, cannot remove the default name of the container")
+			return nil, fmt.Errorf("Conflict, cannot remove the default name of the container")
 		}
 		pe := srv.runtime.containerGraph.Get(parent)
 		if pe == nil {
-			return fmt.Errorf("Cannot get parent %s for name %s", parent, name)
+			return nil, fmt.Errorf("Cannot get parent %s for name %s", parent, name)
 		}
 		parentContainer := srv.runtime.Get(pe.ID())
 
@@ -1353,16 +1634,17 @@ func (srv *Server) ContainerDestroy(name string, removeVolume, removeLink bool)
 		}
 
 		if err := srv.runtime.containerGraph.Delete(name); err != nil {
-			return err
+			return nil, err
 		}
-		return nil
+		return nil, nil
 	}
 
+	var warnings []string
 	if container != nil {
 		if container.State.IsRunning() {
-			return fmt.Errorf("Impossible to remove a running container, please stop it first")
+			return nil, fmt.Errorf("Impossible to remove a running container, please stop it first")
 		}
-		volumes := make(map[string]struct{})
+		volumes := make(map[string]*Volume)
 
 		binds := make(map[string]struct{})
 
@@ -1373,46 +1655,174 @@ func (srv *Server) ContainerDestroy(name string, removeVolume, removeLink bool)
 		}
 
 		// Store all the deleted containers volumes
-		for _, volumeId := range container.Volumes {
+		for volPath, srcPath := range container.Volumes {
 
 			// Skip the volumes mounted from external
-			if _, exists := binds[volumeId]; exists {
+			if _, exists := binds[srcPath]; exists {
 				continue
 			}
 
-			volumeId = strings.TrimSuffix(volumeId, "/layer")
-			volumeId = filepath.Base(volumeId)
-			volumes[volumeId] = struct{}{}
+			// Named volumes are never removed along with a container
+			if volume := container.volume(volPath); volume != nil && volume.Name == "" {
+				volumes[volume.ID] = volume
+			}
 		}
 		if err := srv.runtime.Destroy(container); err != nil {
-			return fmt.Errorf("Cannot destroy container %s: %s", name, err)
+			return nil, fmt.Errorf("Cannot destroy container %s: %s", name, err)
 		}
 		srv.LogEvent("destroy", container.ID, srv.runtime.repositories.ImageName(container.Image))
 
-		if removeVolume {
-			// Retrieve all volumes from all remaining containers
-			usedVolumes := make(map[string]*Container)
-			for _, container := range srv.runtime.List() {
-				for _, containerVolumeId := range container.Volumes {
-					usedVolumes[containerVolumeId] = container
+		// Retrieve all volumes from all remaining containers
+		usedVolumes := srv.volumesContainers()
+		for volumeId, volume := range volumes {
+			if containers, exists := usedVolumes[volumeId]; exists {
+				if removeVolume {
+					warnings = append(warnings, fmt.Sprintf("The volume %s is used by the container %s, it is kept", utils.TruncateID(volumeId), utils.TruncateID(containers[0])))
 				}
+				continue
 			}
-
-			for volumeId := range volumes {
-				// If the requested volu
-				if c, exists := usedVolumes[volumeId]; exists {
-					log.Printf("The volume %s is used by the container %s. Impossible to remove it. Skipping.\n", volumeId, c.ID)
-					continue
-				}
-				if err := srv.runtime.volumes.Delete(volumeId); err != nil {
-					return err
-				}
+			if !removeVolume {
+				warnings = append(warnings, fmt.Sprintf("The volume %s is not used anymore, it is kept until removed with docker volume rm", utils.TruncateID(volumeId)))
+				continue
+			}
+			if err := srv.runtime.volumeStore.Delete(volume); err != nil {
+				return nil, err
 			}
 		}
 	} else {
-		return fmt.Errorf("No such container: %s", name)
+		return nil, fmt.Errorf("No such container: %s", name)
 	}
-	return nil
+	return warnings, nil
+}
+
+// volumesContainers returns the IDs of the containers using each volume,
+// indexed by volume ID.
+func (srv *Server) volumesContainers() map[string][]string {
+	used := make(map[string][]string)
+	for _, container := range srv.runtime.List() {
+		for volPath := range container.Volumes {
+			if volume := container.volume(volPath); volume != nil {
+				used[volume.ID] = append(used[volume.ID], container.ID)
+			}
+		}
+	}
+	return used
+}
+
+func (srv *Server) apiVolume(volume *Volume, used map[string][]string) (*APIVolume, error) {
+	pth, err := srv.runtime.volumeStore.Path(volume)
+	if err != nil {
+		// The volume might live on an unavailable driver
+		utils.Errorf("Unable to get the path of volume %s: %s", volume.ID, err)
+		pth = volume.Mountpoint
+	}
+	containers := used[volume.ID]
+	if containers == nil {
+		containers = []string{}
+	}
+	driver := volume.Driver
+	if driver == "" {
+		driver = DefaultVolumeDriver
+	}
+	return &APIVolume{
+		ID:         volume.ID,
+		Name:       volume.Name,
+		Driver:     driver,
+		Created:    volume.Created.Unix(),
+		Path:       pth,
+		Containers: containers,
+	}, nil
+}
+
+func (srv *Server) VolumeCreate(name, driver string) (*APIVolume, error) {
+	volume, err := srv.runtime.volumeStore.Create(name, driver)
+	if err != nil {
+		return nil, err
+	}
+	return srv.apiVolume(volume, nil)
+}
+
+func (srv *Server) Volumes() ([]APIVolume, error) {
+	volumes, err := srv.runtime.volumeStore.List()
+	if err != nil {
+		return nil, err
+	}
+	used := srv.volumesContainers()
+	outs := []APIVolume{}
+	for _, volume := range volumes {
+		out, err := srv.apiVolume(volume, used)
+		if err != nil {
+			return nil, err
+		}
+		outs = append(outs, *out)
+	}
+	return outs, nil
+}
+
+func (srv *Server) VolumeInspect(name string) (*APIVolume, error) {
+	volume, err := srv.runtime.volumeStore.Get(name)
+	if err != nil {
+		return nil, err
+	}
+	return srv.apiVolume(volume, srv.volumesContainers())
+}
+
+// VolumeDestroy removes a volume and its content. Volumes still used by a
+// container, even a stopped one, can't be removed.
+func (srv *Server) VolumeDestroy(name string) error {
+	volume, err := srv.runtime.volumeStore.Get(name)
+	if err != nil {
+		return err
+	}
+	if containers, exists := srv.volumesContainers()[volume.ID]; exists {
+		for i, id := range containers {
+			containers[i] = utils.TruncateID(id)
+		}
+		return fmt.Errorf("Conflict, the volume %s is used by the container(s) %s", name, strings.Join(containers, ", "))
+	}
+	return srv.runtime.volumeStore.Delete(volume)
+}
+
+// VolumesPrune removes the volumes which no container references, and
+// reports their sizes. Named volumes are only removed if all is set, and
+// nothing is removed if dryRun is set. A non-empty ids restricts the
+// removal to these volumes, eg. to those a user confirmed after a dry run.
+func (srv *Server) VolumesPrune(all, dryRun bool, ids []string) (*APIVolumesPrune, error) {
+	volumes, err := srv.runtime.volumeStore.List()
+	if err != nil {
+		return nil, err
+	}
+	confirmed := make(map[string]bool)
+	for _, id := range ids {
+		confirmed[id] = true
+	}
+	used := srv.volumesContainers()
+	out := &APIVolumesPrune{Volumes: []APIVolume{}}
+	for _, volume := range volumes {
+		if _, exists := used[volume.ID]; exists || (volume.Name != "" && !all) {
+			continue
+		}
+		if len(confirmed) > 0 && !confirmed[volume.ID] {
+			continue
+		}
+		apiVolume, err := srv.apiVolume(volume, used)
+		if err != nil {
+			return nil, err
+		}
+		if apiVolume.Path != "" {
+			if apiVolume.Size, err = utils.TreeSize(apiVolume.Path); err != nil {
+				utils.Errorf("Unable to compute the size of volume %s: %s", volume.ID, err)
+			}
+		}
+		if !dryRun {
+			if err := srv.runtime.volumeStore.Delete(volume); err != nil {
+				return nil, err
+			}
+		}
+		out.Volumes = append(out.Volumes, *apiVolume)
+		out.SpaceReclaimed += apiVolume.Size
+	}
+	return out, nil
 }
 
 var ErrImageReferenced = errors.New("Image referenced by a repository")
@@ -1562,33 +1972,7 @@ func (srv *Server) ImageDelete(name string, autoPrune bool) ([]APIRmi, error) {
 }
 
 func (srv *Server) ImageGetCached(imgID string, config *Config) (*Image, error) {
-
-	// Retrieve all images
-	images, err := srv.runtime.graph.Map()
-	if err != nil {
-		return nil, err
-	}
-
-	// Store the tree in a map of map (map[parentId][childId])
-	imageMap := make(map[string]map[string]struct{})
-	for _, img := range images {
-		if _, exists := imageMap[img.Parent]; !exists {
-			imageMap[img.Parent] = make(map[string]struct{})
-		}
-		imageMap[img.Parent][img.ID] = struct{}{}
-	}
-
-	// Loop on the children of the given image and check the config
-	for elem := range imageMap[imgID] {
-		img, err := srv.runtime.graph.Get(elem)
-		if err != nil {
-			return nil, err
-		}
-		if CompareConfig(&img.ContainerConfig, config) {
-			return img, nil
-		}
-	}
-	return nil, nil
+	return srv.runtime.graph.GetCachedChild(imgID, config)
 }
 
 func (srv *Server) RegisterLinks(name string, hostConfig *HostConfig) error {
@@ -1626,6 +2010,82 @@ func (srv *Server) RegisterLinks(name string, hostConfig *HostConfig) error {
 	return nil
 }
 
+// validateHostConfig checks the host config of a container before it is
+// started with it, and normalizes its capabilities.
+func validateHostConfig(config *Config, hostConfig *HostConfig) error {
+	// Validate the HostConfig binds. Make sure that:
+	// 1) the source of a bind mount isn't /
+	//         The bind mount "/:/foo" isn't allowed.
+	// 2) Check that the source exists
+	//        The source to be bind mounted must exist.
+	for _, bind := range hostConfig.Binds {
+		splitBind := strings.Split(bind, ":")
+		source := splitBind[0]
+
+		// a source which is not a path is the name of a volume
+		if !path.IsAbs(source) {
+			if !validVolumeName.MatchString(source) {
+				return fmt.Errorf("Invalid bind mount '%s' : invalid volume name, only [a-zA-Z0-9_.-] are allowed", bind)
+			}
+			continue
+		}
+
+		// refuse to bind mount "/" to the container
+		if source == "/" {
+			return fmt.Errorf("Invalid bind mount '%s' : source can't be '/'", bind)
+		}
+
+		// ensure the source exists on the host
+		_, err := os.Stat(source)
+		if err != nil && os.IsNotExist(err) {
+			return fmt.Errorf("Invalid bind mount '%s' : source doesn't exist", bind)
+		}
+	}
+	// Validate the requested capabilities
+	capAdd, err := parseCapabilities(hostConfig.CapAdd)
+	if err != nil {
+		return err
+	}
+	capDrop, err := parseCapabilities(hostConfig.CapDrop)
+	if err != nil {
+		return err
+	}
+	hostConfig.CapAdd, hostConfig.CapDrop = capAdd, capDrop
+	for _, group := range hostConfig.GroupAdd {
+		if group == "" || strings.Contains(group, ",") {
+			return fmt.Errorf("Invalid group: %s", group)
+		}
+	}
+	// Validate the tmpfs mounts, which can't be volumes as well
+	for tmpfsPath, options := range hostConfig.Tmpfs {
+		if dst, _, err := parseTmpfs(tmpfsPath + ":" + options); err != nil {
+			return err
+		} else if dst != tmpfsPath {
+			return fmt.Errorf("Invalid tmpfs path '%s' : must be a clean absolute path", tmpfsPath)
+		}
+		if _, exists := config.Volumes[tmpfsPath]; exists {
+			return fmt.Errorf("Invalid tmpfs path '%s' : already a volume", tmpfsPath)
+		}
+		for _, bind := range hostConfig.Binds {
+			if splitBind := strings.Split(bind, ":"); len(splitBind) > 1 && path.Clean(splitBind[1]) == tmpfsPath {
+				return fmt.Errorf("Invalid tmpfs path '%s' : already a bind mount", tmpfsPath)
+			}
+		}
+	}
+	for _, ulimit := range hostConfig.Ulimits {
+		if err := ulimit.Validate(); err != nil {
+			return err
+		}
+	}
+	// Ensure the requested devices exist on the host
+	for _, device := range hostConfig.Devices {
+		if _, err := getDevice(device); err != nil {
+			return fmt.Errorf("Invalid device '%s' : %s", device.PathOnHost, err)
+		}
+	}
+	return nil
+}
+
 func (srv *Server) ContainerStart(job *engine.Job) string {
 	if len(job.Args) < 1 {
 		return fmt.Sprintf("Usage: %s container_id", job.Name)
@@ -1643,25 +2103,8 @@ func (srv *Server) ContainerStart(job *engine.Job) string {
 		if err := job.ExportEnv(&hostConfig); err != nil {
 			return err.Error()
 		}
-		// Validate the HostConfig binds. Make sure that:
-		// 1) the source of a bind mount isn't /
-		//         The bind mount "/:/foo" isn't allowed.
-		// 2) Check that the source exists
-		//        The source to be bind mounted must exist.
-		for _, bind := range hostConfig.Binds {
-			splitBind := strings.Split(bind, ":")
-			source := splitBind[0]
-
-			// refuse to bind mount "/" to the container
-			if source == "/" {
-				return fmt.Sprintf("Invalid bind mount '%s' : source can't be '/'", bind)
-			}
-
-			// ensure the source exists on the host
-			_, err := os.Stat(source)
-			if err != nil && os.IsNotExist(err) {
-				return fmt.Sprintf("Invalid bind mount '%s' : source doesn't exist", bind)
-			}
+		if err := validateHostConfig(container.Config, &hostConfig); err != nil {
+			return err.Error()
 		}
 		// Register any links from the host config before starting the container
 		// FIXME: we could just pass the container here, no need to lookup by name again.
@@ -97,3 +97,26 @@ func setTimeout(t *testing.T, msg string, d time.Duration, f func()) {
 		t.Fatal(msg)
 	}
 }
+
+func TestValidateHostConfig(t *testing.T) {
+	config := &Config{Volumes: map[string]struct{}{"/data": {}}}
+	for _, hostConfig := range []*HostConfig{
+		{Binds: []string{"/:/host"}},
+		{Binds: []string{"/nonexistent-source:/data"}},
+		{CapAdd: []string{"nonexistent"}},
+		{Tmpfs: map[string]string{"/data": ""}},
+		{Devices: []DeviceMapping{{PathOnHost: "/dev/nonexistent", PathInContainer: "/dev/foo", CgroupPermissions: "rwm"}}},
+	} {
+		if err := validateHostConfig(config, hostConfig); err == nil {
+			t.Errorf("Expected %+v to be rejected", *hostConfig)
+		}
+	}
+
+	hostConfig := &HostConfig{Binds: []string{"/tmp:/tmp"}, CapAdd: []string{"NET_ADMIN"}}
+	if err := validateHostConfig(config, hostConfig); err != nil {
+		t.Fatal(err)
+	}
+	if len(hostConfig.CapAdd) != 1 || hostConfig.CapAdd[0] != "net_admin" {
+		t.Fatalf("Expected the capabilities to be normalized, got %v", hostConfig.CapAdd)
+	}
+}
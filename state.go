@@ -15,6 +15,7 @@ type State struct {
 	StartedAt  time.Time
 	FinishedAt time.Time
 	Ghost      bool
+	Health     *Health `json:",omitempty"`
 }
 
 // String returns a human-readable description of the state
@@ -26,6 +27,9 @@ func (s *State) String() string {
 		if s.Ghost {
 			return fmt.Sprintf("Ghost")
 		}
+		if s.Health != nil {
+			return fmt.Sprintf("Up %s (%s)", utils.HumanDuration(time.Now().UTC().Sub(s.StartedAt)), s.Health.Status)
+		}
 		return fmt.Sprintf("Up %s", utils.HumanDuration(time.Now().UTC().Sub(s.StartedAt)))
 	}
 	return fmt.Sprintf("Exit %d", s.ExitCode)
@@ -79,3 +83,38 @@ func (s *State) SetStopped(exitCode int) {
 	s.FinishedAt = time.Now().UTC()
 	s.ExitCode = exitCode
 }
+
+func (s *State) SetHealth(health *Health) {
+	s.Lock()
+	defer s.Unlock()
+
+	s.Health = health
+}
+
+// AddHealthResult records the result of a health check and updates the health status.
+// It returns the new status and whether it changed.
+func (s *State) AddHealthResult(result *HealthcheckResult, retries int) (string, bool) {
+	s.Lock()
+	defer s.Unlock()
+
+	if s.Health == nil {
+		return "", false
+	}
+	previous := s.Health.Status
+
+	s.Health.Log = append(s.Health.Log, result)
+	if len(s.Health.Log) > maxHealthLogEntries {
+		s.Health.Log = s.Health.Log[len(s.Health.Log)-maxHealthLogEntries:]
+	}
+
+	if result.ExitCode == 0 {
+		s.Health.FailingStreak = 0
+		s.Health.Status = Healthy
+	} else {
+		s.Health.FailingStreak += 1
+		if s.Health.FailingStreak >= retries {
+			s.Health.Status = Unhealthy
+		}
+	}
+	return s.Health.Status, s.Health.Status != previous
+}
@@ -0,0 +1,102 @@
+package docker
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStateHealth(t *testing.T) {
+	state := &State{}
+	if _, changed := state.AddHealthResult(&HealthcheckResult{ExitCode: 1}, 2); changed {
+		t.Fatal("A container without health check should not change health")
+	}
+
+	state.SetHealth(&Health{Status: HealthStarting})
+	if status, changed := state.AddHealthResult(&HealthcheckResult{ExitCode: 1}, 2); changed || status != HealthStarting {
+		t.Fatalf("Expected %s after one failure, got %s", HealthStarting, status)
+	}
+	if status, changed := state.AddHealthResult(&HealthcheckResult{ExitCode: 1}, 2); !changed || status != Unhealthy {
+		t.Fatalf("Expected %s after two failures, got %s", Unhealthy, status)
+	}
+	if status, changed := state.AddHealthResult(&HealthcheckResult{ExitCode: 0}, 2); !changed || status != Healthy {
+		t.Fatalf("Expected %s after a success, got %s", Healthy, status)
+	}
+	if state.Health.FailingStreak != 0 {
+		t.Fatalf("Expected the failing streak to be reset, got %d", state.Health.FailingStreak)
+	}
+
+	for i := 0; i < 2*maxHealthLogEntries; i++ {
+		state.AddHealthResult(&HealthcheckResult{ExitCode: 0}, 2)
+	}
+	if len(state.Health.Log) != maxHealthLogEntries {
+		t.Fatalf("Expected %d log entries, got %d", maxHealthLogEntries, len(state.Health.Log))
+	}
+}
+
+func TestHealthConfigIsDisabled(t *testing.T) {
+	var config *HealthConfig
+	if !config.IsDisabled() {
+		t.Fatal("A nil health config should be disabled")
+	}
+	if !(&HealthConfig{Test: []string{"NONE"}}).IsDisabled() {
+		t.Fatal("NONE should disable the health check")
+	}
+	if (&HealthConfig{Test: []string{"/bin/true"}}).IsDisabled() {
+		t.Fatal("A health check with a command should be enabled")
+	}
+}
+
+func TestHealthMonitorStop(t *testing.T) {
+	container := &Container{
+		ID:     "health-monitor-stop",
+		Config: &Config{Healthcheck: &HealthConfig{Test: []string{"/bin/true"}, Interval: time.Hour}},
+	}
+
+	stop := container.startHealthMonitor()
+	done := make(chan struct{})
+	go func() {
+		stop()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Stopping the health monitor should not wait for the next check")
+	}
+	if container.State.Health == nil || container.State.Health.Status != HealthStarting || len(container.State.Health.Log) != 0 {
+		t.Fatalf("Expected no health check result, got %v", container.State.Health)
+	}
+}
+
+func TestProbeHealthTimeout(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "docker-test-health")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	// A check leaving a process in the background, which holds its output open
+	script := "#!/bin/sh\nsleep 60 &\nsleep 60\n"
+	if err := ioutil.WriteFile(path.Join(tmp, "lxc-attach"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Setenv("PATH", os.Getenv("PATH"))
+	os.Setenv("PATH", tmp+":"+os.Getenv("PATH"))
+
+	container := &Container{ID: "health-probe-timeout"}
+	done := make(chan *HealthcheckResult)
+	go func() {
+		done <- container.probeHealth([]string{"/bin/true"}, 100*time.Millisecond, nil)
+	}()
+	select {
+	case result := <-done:
+		if result.ExitCode != -1 || !strings.HasPrefix(result.Output, "Health check exceeded timeout") {
+			t.Fatalf("Expected the check to time out, got %d: %s", result.ExitCode, result.Output)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("A timed out check should not wait for the processes it started")
+	}
+}
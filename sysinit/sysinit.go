@@ -11,9 +11,11 @@ import (
 	"net"
 	"os"
 	"os/exec"
+	"os/signal"
 	"strconv"
 	"strings"
 	"syscall"
+	"unsafe"
 )
 
 // Setup networking
@@ -43,25 +45,80 @@ func setupWorkingDirectory(workdir string) {
 	}
 }
 
-// Takes care of dropping privileges to the desired user
-func changeUser(u string) {
-	if u == "" {
-		return
+// Resolve a group name or gid against the container's /etc/group
+func lookupGid(g string) (int, error) {
+	if group, err := utils.GroupLookup(g); err == nil {
+		return strconv.Atoi(group.Gid)
 	}
-	userent, err := utils.UserLookup(u)
+	gid, err := strconv.Atoi(g)
 	if err != nil {
-		log.Fatalf("Unable to find user %v: %v", u, err)
+		return -1, fmt.Errorf("Unable to find group %v", g)
 	}
+	return gid, nil
+}
 
-	uid, err := strconv.Atoi(userent.Uid)
-	if err != nil {
-		log.Fatalf("Invalid uid: %v", userent.Uid)
+// Takes care of dropping privileges to the desired user.
+// The user is given as user[:group], each part being a name or a number,
+// and extraGroups are added to the supplementary groups of the user.
+func changeUser(u string, extraGroups []string) {
+	if u == "" {
+		if len(extraGroups) == 0 {
+			return
+		}
+		// The supplementary groups are also added to the default user
+		u = "0"
 	}
-	gid, err := strconv.Atoi(userent.Gid)
-	if err != nil {
-		log.Fatalf("Invalid gid: %v", userent.Gid)
+	parts := strings.SplitN(u, ":", 2)
+
+	var (
+		uid, gid int
+		groups   []int
+	)
+	if userent, err := utils.UserLookup(parts[0]); err == nil {
+		if uid, err = strconv.Atoi(userent.Uid); err != nil {
+			log.Fatalf("Invalid uid: %v", userent.Uid)
+		}
+		if gid, err = strconv.Atoi(userent.Gid); err != nil {
+			log.Fatalf("Invalid gid: %v", userent.Gid)
+		}
+		// Supplementary groups of the user
+		userGroups, err := utils.UserGroups(userent.Username)
+		if err != nil && !os.IsNotExist(err) {
+			log.Fatalf("Unable to read groups of user %v: %v", u, err)
+		}
+		for _, group := range userGroups {
+			g, err := strconv.Atoi(group.Gid)
+			if err != nil {
+				log.Fatalf("Invalid gid: %v", group.Gid)
+			}
+			groups = append(groups, g)
+		}
+	} else if uid, err = strconv.Atoi(parts[0]); err == nil {
+		// Numeric uids don't need to exist in /etc/passwd, their
+		// primary group is then root's
+		gid = 0
+	} else {
+		log.Fatalf("Unable to find user %v: %v", parts[0], err)
 	}
 
+	if len(parts) == 2 {
+		g, err := lookupGid(parts[1])
+		if err != nil {
+			log.Fatal(err)
+		}
+		gid = g
+	}
+	for _, extra := range extraGroups {
+		g, err := lookupGid(extra)
+		if err != nil {
+			log.Fatal(err)
+		}
+		groups = append(groups, g)
+	}
+
+	if err := syscall.Setgroups(groups); err != nil {
+		log.Fatalf("setgroups failed: %v", err)
+	}
 	if err := syscall.Setgid(gid); err != nil {
 		log.Fatalf("setgid failed: %v", err)
 	}
@@ -70,6 +127,68 @@ func changeUser(u string) {
 	}
 }
 
+// Apply the resource limits given as a comma separated list of name=soft:hard.
+// This must happen before dropping privileges, as raising a hard limit
+// requires the sys_resource capability, which lxc then leaves to us to drop.
+func setupUlimits(ulimits string, dropSysResource bool) {
+	if ulimits == "" {
+		return
+	}
+	for _, rawUlimit := range strings.Split(ulimits, ",") {
+		ulimit, err := utils.ParseUlimit(rawUlimit)
+		if err != nil {
+			log.Fatal(err)
+		}
+		resource, err := ulimit.Resource()
+		if err != nil {
+			log.Fatal(err)
+		}
+		// -1 converts to RLIM_INFINITY
+		rlimit := &syscall.Rlimit{Cur: uint64(ulimit.Soft), Max: uint64(ulimit.Hard)}
+		if err := syscall.Setrlimit(resource, rlimit); err != nil {
+			log.Fatalf("Unable to set ulimit %v: %v", ulimit, err)
+		}
+	}
+	if dropSysResource {
+		if err := dropCapability(capSysResource); err != nil {
+			log.Fatalf("Unable to drop the sys_resource capability: %v", err)
+		}
+	}
+}
+
+const (
+	capSysResource = 24
+	// _LINUX_CAPABILITY_VERSION_3, whose capability sets are 64 bits
+	linuxCapabilityVersion3 = 0x20080522
+)
+
+// dropCapability drops a capability as lxc.cap.drop does, from the bounding
+// set inherited by the program, and from our own sets too.
+func dropCapability(capability uint) error {
+	if _, _, errno := syscall.RawSyscall(syscall.SYS_PRCTL, syscall.PR_CAPBSET_DROP, uintptr(capability), 0); errno != 0 {
+		return errno
+	}
+	header := struct {
+		version uint32
+		pid     int32
+	}{version: linuxCapabilityVersion3}
+	var data [2]struct {
+		effective, permitted, inheritable uint32
+	}
+	if _, _, errno := syscall.RawSyscall(syscall.SYS_CAPGET, uintptr(unsafe.Pointer(&header)), uintptr(unsafe.Pointer(&data[0])), 0); errno != 0 {
+		return errno
+	}
+	mask := ^uint32(1 << (capability % 32))
+	set := &data[capability/32]
+	set.effective &= mask
+	set.permitted &= mask
+	set.inheritable &= mask
+	if _, _, errno := syscall.RawSyscall(syscall.SYS_CAPSET, uintptr(unsafe.Pointer(&header)), uintptr(unsafe.Pointer(&data[0])), 0); errno != 0 {
+		return errno
+	}
+	return nil
+}
+
 // Clear environment pollution introduced by lxc-start
 func cleanupEnv() {
 	os.Clearenv()
@@ -103,6 +222,58 @@ func executeProgram(name string, args []string) {
 	}
 }
 
+// Run the program as a child and stay as the container's init process:
+// forward all signals to the child, reap the zombies left by orphaned
+// processes, and exit with the child's status once it exits.
+func executeProgramAsInit(name string, args []string) {
+	path, err := exec.LookPath(name)
+	if err != nil {
+		log.Printf("Unable to locate %v", name)
+		os.Exit(127)
+	}
+
+	// Catch signals before starting the child so that no SIGCHLD is missed
+	sigc := make(chan os.Signal, 32)
+	utils.CatchAll(sigc)
+
+	process, err := os.StartProcess(path, args, &os.ProcAttr{
+		Env:   os.Environ(),
+		Files: []*os.File{os.Stdin, os.Stdout, os.Stderr},
+	})
+	if err != nil {
+		log.Fatalf("Unable to start %v: %v", name, err)
+	}
+
+	for sig := range sigc {
+		// The Go runtime sends itself SIGURG to preempt goroutines, which
+		// can't be told apart from one meant for the child
+		if sig == syscall.SIGURG {
+			continue
+		}
+		if sig != syscall.SIGCHLD {
+			if err := process.Signal(sig); err != nil {
+				log.Printf("Unable to forward signal %v: %v", sig, err)
+			}
+			continue
+		}
+		// Reap every exited child, including orphans reparented to us
+		for {
+			var status syscall.WaitStatus
+			pid, err := syscall.Wait4(-1, &status, syscall.WNOHANG, nil)
+			if err != nil || pid <= 0 {
+				break
+			}
+			if pid == process.Pid {
+				signal.Stop(sigc)
+				if status.Signaled() {
+					os.Exit(128 + int(status.Signal()))
+				}
+				os.Exit(status.ExitStatus())
+			}
+		}
+	}
+}
+
 // Sys Init code
 // This code is run INSIDE the container and is responsible for setting
 // up the environment before running the actual process
@@ -111,15 +282,28 @@ func SysInit() {
 		fmt.Println("You should not invoke dockerinit manually")
 		os.Exit(1)
 	}
-	var u = flag.String("u", "", "username or uid")
+	var u = flag.String("u", "", "username or uid, optionally followed by :groupname or :gid")
+	var groups = flag.String("groups", "", "comma separated list of supplementary groups")
 	var gw = flag.String("g", "", "gateway address")
 	var workdir = flag.String("w", "", "workdir")
+	var ulimits = flag.String("ulimits", "", "comma separated list of resource limits (name=soft:hard)")
+	var dropSysResource = flag.Bool("drop-sys-resource", false, "drop the sys_resource capability once the resource limits are set")
+	var runInit = flag.Bool("init", false, "run the program as a child, forwarding signals and reaping zombies")
 
 	flag.Parse()
 
 	cleanupEnv()
 	setupNetworking(*gw)
 	setupWorkingDirectory(*workdir)
-	changeUser(*u)
-	executeProgram(flag.Arg(0), flag.Args())
+	setupUlimits(*ulimits, *dropSysResource)
+	var extraGroups []string
+	if *groups != "" {
+		extraGroups = strings.Split(*groups, ",")
+	}
+	changeUser(*u, extraGroups)
+	if *runInit {
+		executeProgramAsInit(flag.Arg(0), flag.Args())
+	} else {
+		executeProgram(flag.Arg(0), flag.Args())
+	}
 }
@@ -22,6 +22,9 @@ btrfs_reflink(int fd_out, int fd_in)
 */
 import "C"
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"github.com/dotcloud/docker/archive"
 	"github.com/dotcloud/docker/namesgenerator"
@@ -29,6 +32,9 @@ import (
 	"io"
 	"io/ioutil"
 	"os"
+	"path"
+	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 	"syscall"
@@ -51,9 +57,15 @@ func CompareConfig(a, b *Config) bool {
 		a.Memory != b.Memory ||
 		a.MemorySwap != b.MemorySwap ||
 		a.CpuShares != b.CpuShares ||
+		a.CpusetCpus != b.CpusetCpus ||
+		a.CpusetMems != b.CpusetMems ||
+		a.BlkioWeight != b.BlkioWeight ||
 		a.OpenStdin != b.OpenStdin ||
 		a.Tty != b.Tty ||
-		a.VolumesFrom != b.VolumesFrom {
+		a.VolumesFrom != b.VolumesFrom ||
+		a.StopSignal != b.StopSignal ||
+		a.Init != b.Init ||
+		!compareHealthConfig(a.Healthcheck, b.Healthcheck) {
 		return false
 	}
 	if len(a.Cmd) != len(b.Cmd) ||
@@ -104,6 +116,37 @@ func CompareConfig(a, b *Config) bool {
 	return true
 }
 
+// configDigest returns a digest of the fields of a config compared by
+// CompareConfig: configs which compare equal have the same digest.
+func configDigest(config *Config) string {
+	nilIfEmpty := func(list []string) []string {
+		if len(list) == 0 {
+			return nil
+		}
+		return list
+	}
+	exposedPorts := make([]string, 0, len(config.ExposedPorts))
+	for port := range config.ExposedPorts {
+		exposedPorts = append(exposedPorts, string(port))
+	}
+	sort.Strings(exposedPorts)
+	volumes := make([]string, 0, len(config.Volumes))
+	for volume := range config.Volumes {
+		volumes = append(volumes, volume)
+	}
+	sort.Strings(volumes)
+
+	data, _ := json.Marshal([]interface{}{
+		config.AttachStdout, config.AttachStderr, config.User,
+		config.Memory, config.MemorySwap, config.CpuShares, config.CpusetCpus, config.CpusetMems, config.BlkioWeight,
+		config.OpenStdin, config.Tty, config.VolumesFrom, config.StopSignal, config.Init, config.Healthcheck,
+		nilIfEmpty(config.Cmd), nilIfEmpty(config.Dns), nilIfEmpty(config.Env), nilIfEmpty(config.PortSpecs),
+		nilIfEmpty(exposedPorts), nilIfEmpty(config.Entrypoint), nilIfEmpty(volumes),
+	})
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
 func MergeConfig(userConf, imageConf *Config) error {
 	if userConf.User == "" {
 		userConf.User = imageConf.User
@@ -117,6 +160,15 @@ func MergeConfig(userConf, imageConf *Config) error {
 	if userConf.CpuShares == 0 {
 		userConf.CpuShares = imageConf.CpuShares
 	}
+	if userConf.CpusetCpus == "" {
+		userConf.CpusetCpus = imageConf.CpusetCpus
+	}
+	if userConf.CpusetMems == "" {
+		userConf.CpusetMems = imageConf.CpusetMems
+	}
+	if userConf.BlkioWeight == 0 {
+		userConf.BlkioWeight = imageConf.BlkioWeight
+	}
 	if userConf.ExposedPorts == nil || len(userConf.ExposedPorts) == 0 {
 		userConf.ExposedPorts = imageConf.ExposedPorts
 	} else if imageConf.ExposedPorts != nil {
@@ -205,6 +257,15 @@ func MergeConfig(userConf, imageConf *Config) error {
 	if userConf.VolumesFrom == "" {
 		userConf.VolumesFrom = imageConf.VolumesFrom
 	}
+	if userConf.Healthcheck == nil {
+		userConf.Healthcheck = imageConf.Healthcheck
+	}
+	if userConf.StopSignal == "" {
+		userConf.StopSignal = imageConf.StopSignal
+	}
+	if !userConf.Init {
+		userConf.Init = imageConf.Init
+	}
 	if userConf.Volumes == nil || len(userConf.Volumes) == 0 {
 		userConf.Volumes = imageConf.Volumes
 	} else {
@@ -235,6 +296,115 @@ func parseLxcOpt(opt string) (string, string, error) {
 	return strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1]), nil
 }
 
+// Capabilities are accepted in any case, with or without the CAP_ prefix,
+// and are normalized to the lowercase form used by lxc.
+// The special value "all" stands for every known capability.
+func parseCapabilities(caps []string) ([]string, error) {
+	out := make([]string, 0, len(caps))
+	for _, c := range caps {
+		c = strings.TrimPrefix(strings.ToLower(strings.TrimSpace(c)), "cap_")
+		if c != "all" {
+			found := false
+			for _, known := range allCapabilities {
+				if c == known {
+					found = true
+					break
+				}
+			}
+			if !found {
+				return nil, fmt.Errorf("Unknown capability: %s", c)
+			}
+		}
+		out = append(out, c)
+	}
+	return out, nil
+}
+
+var tmpfsSizeRegexp = regexp.MustCompile(`^[0-9]+[kKmMgG%]?$`)
+
+// Tmpfs mounts come in the format of path[:options], the options being
+// a comma separated list of size=<size> and mode=<octal mode>,
+// eg. /run:size=64m,mode=755
+func parseTmpfs(rawTmpfs string) (string, string, error) {
+	parts := strings.SplitN(rawTmpfs, ":", 2)
+	dst := path.Clean(parts[0])
+	if !path.IsAbs(parts[0]) || dst == "/" {
+		return "", "", fmt.Errorf("Invalid tmpfs specification: %s (path must be absolute and not /)", rawTmpfs)
+	}
+	if len(parts) == 1 || parts[1] == "" {
+		return dst, "", nil
+	}
+	for _, opt := range strings.Split(parts[1], ",") {
+		kv := strings.SplitN(opt, "=", 2)
+		if len(kv) != 2 {
+			return "", "", fmt.Errorf("Invalid tmpfs option: %s", opt)
+		}
+		switch kv[0] {
+		case "size":
+			if !tmpfsSizeRegexp.MatchString(kv[1]) {
+				return "", "", fmt.Errorf("Invalid tmpfs size: %s (format: <number><optional unit>, where unit = k, m, g or %%)", kv[1])
+			}
+		case "mode":
+			if mode, err := strconv.ParseUint(kv[1], 8, 32); err != nil || mode > 07777 {
+				return "", "", fmt.Errorf("Invalid tmpfs mode: %s (must be an octal mode)", kv[1])
+			}
+		default:
+			return "", "", fmt.Errorf("Invalid tmpfs option: %s (only size and mode are supported)", opt)
+		}
+	}
+	return dst, parts[1], nil
+}
+
+// excludeChanges drops the changes made at or under the given paths
+func excludeChanges(changes []archive.Change, paths []string) []archive.Change {
+	if len(paths) == 0 {
+		return changes
+	}
+	filtered := make([]archive.Change, 0, len(changes))
+	for _, change := range changes {
+		excluded := false
+		for _, p := range paths {
+			if change.Path == p || strings.HasPrefix(change.Path, p+"/") {
+				excluded = true
+				break
+			}
+		}
+		if !excluded {
+			filtered = append(filtered, change)
+		}
+	}
+	return filtered
+}
+
+// Cpusets come in the format of a comma separated list of
+// ids or ranges, eg. 0-3,7
+func validateCpuset(cpuset string) error {
+	for _, part := range strings.Split(cpuset, ",") {
+		bounds := strings.SplitN(part, "-", 2)
+		for _, bound := range bounds {
+			if _, err := strconv.ParseUint(bound, 10, 16); err != nil {
+				return fmt.Errorf("Invalid cpuset specification: %s", cpuset)
+			}
+		}
+		if len(bounds) == 2 {
+			low, _ := strconv.Atoi(bounds[0])
+			high, _ := strconv.Atoi(bounds[1])
+			if low > high {
+				return fmt.Errorf("Invalid cpuset specification: %s", cpuset)
+			}
+		}
+	}
+	return nil
+}
+
+// Block IO weights are either unset (0) or in the range accepted by the kernel
+func validateBlkioWeight(weight int64) error {
+	if weight != 0 && (weight < 10 || weight > 1000) {
+		return fmt.Errorf("Invalid block IO weight: %d (must be between 10 and 1000)", weight)
+	}
+	return nil
+}
+
 // FIXME: network related stuff (including parsing) should be grouped in network file
 const (
 	PortSpecTemplate       = "ip:hostPort:containerPort"
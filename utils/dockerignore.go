@@ -0,0 +1,137 @@
+package utils
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ReadDockerIgnore reads the patterns of a .dockerignore file, one per
+// line, skipping empty lines and comments. A pattern starting with '!'
+// is an exception, re-including the files matched by the patterns
+// before it. A missing file means no patterns.
+func ReadDockerIgnore(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+
+	var patterns []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		pattern := strings.TrimSpace(scanner.Text())
+		if pattern == "" || pattern[0] == '#' {
+			continue
+		}
+		exception := strings.HasPrefix(pattern, "!")
+		pattern = strings.TrimPrefix(filepath.Clean(strings.TrimPrefix(pattern, "!")), "/")
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("Invalid .dockerignore pattern: %s", scanner.Text())
+		}
+		if exception {
+			pattern = "!" + pattern
+		}
+		patterns = append(patterns, pattern)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return patterns, nil
+}
+
+// MatchesDockerIgnore returns true if the patterns of a .dockerignore file
+// exclude the given path, relative to the root of the build context. A
+// pattern matching a directory matches everything below it, and the last
+// pattern matching the path decides.
+func MatchesDockerIgnore(file string, patterns []string) (bool, error) {
+	file = filepath.Clean(file)
+	excluded := false
+	for _, pattern := range patterns {
+		exception := strings.HasPrefix(pattern, "!")
+		pattern = strings.TrimPrefix(pattern, "!")
+		if exception == !excluded {
+			// The pattern can't change the outcome
+			continue
+		}
+		// Match the path and its parent directories
+		for parent := file; parent != "." && parent != "/"; parent = filepath.Dir(parent) {
+			matched, err := filepath.Match(pattern, parent)
+			if err != nil {
+				return false, err
+			}
+			if matched {
+				excluded = !exception
+				break
+			}
+		}
+	}
+	return excluded, nil
+}
+
+// HasDockerIgnoreExceptions returns true if some patterns are exceptions,
+// in which case the content of an excluded directory may still be included.
+func HasDockerIgnoreExceptions(patterns []string) bool {
+	for _, pattern := range patterns {
+		if strings.HasPrefix(pattern, "!") {
+			return true
+		}
+	}
+	return false
+}
+
+// WalkDockerIgnore walks the build context dir and applies its .dockerignore
+// file. The Dockerfile, given relative to dir, and the .dockerignore file
+// itself are never excluded. It returns the paths, relative to dir, which
+// are kept and those which are excluded. An excluded directory is not
+// walked into, unless exceptions may re-include files below it, in which
+// case it is in neither list.
+func WalkDockerIgnore(dir, dockerfile string) (included, excluded []string, err error) {
+	patterns, err := ReadDockerIgnore(filepath.Join(dir, ".dockerignore"))
+	if err != nil {
+		return nil, nil, err
+	}
+	if dockerfile == "" {
+		dockerfile = "Dockerfile"
+	}
+	dockerfile = strings.TrimPrefix(filepath.Clean(dockerfile), "/")
+	// A Dockerfile in a subdirectory is an exception too
+	hasExceptions := HasDockerIgnoreExceptions(patterns) || strings.Contains(dockerfile, "/")
+	patterns = append(patterns, "!"+dockerfile, "!.dockerignore")
+
+	err = filepath.Walk(dir, func(filePath string, f os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		relPath, err := filepath.Rel(dir, filePath)
+		if err != nil {
+			return err
+		}
+		if relPath == "." {
+			return nil
+		}
+		matched, err := MatchesDockerIgnore(relPath, patterns)
+		if err != nil {
+			return err
+		}
+		switch {
+		case !matched:
+			included = append(included, relPath)
+		case !f.IsDir():
+			excluded = append(excluded, relPath)
+		case !hasExceptions:
+			excluded = append(excluded, relPath)
+			return filepath.SkipDir
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return included, excluded, nil
+}
@@ -1,8 +1,10 @@
 package utils
 
 import (
+	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 	"syscall"
 )
 
@@ -33,3 +35,44 @@ func TreeSize(dir string) (size int64, err error) {
 	})
 	return
 }
+
+// FollowSymlinkInScope returns the host path of pth in the filesystem at
+// root, resolving its symlinks as if root were "/": neither an absolute
+// symlink nor ".." lead out of root. The path may not exist.
+func FollowSymlinkInScope(pth, root string) (string, error) {
+	root = filepath.Clean(root)
+	resolved := "/"
+	components := strings.Split(pth, "/")
+	for links := 0; len(components) > 0; {
+		name := components[0]
+		components = components[1:]
+		if name == "" || name == "." {
+			continue
+		}
+		if name == ".." {
+			resolved = filepath.Dir(resolved)
+			continue
+		}
+		next := filepath.Join(resolved, name)
+		fi, err := os.Lstat(filepath.Join(root, next))
+		if err != nil && !os.IsNotExist(err) {
+			return "", err
+		}
+		if err != nil || fi.Mode()&os.ModeSymlink == 0 {
+			resolved = next
+			continue
+		}
+		if links += 1; links > 255 {
+			return "", fmt.Errorf("Too many levels of symbolic links: %s", pth)
+		}
+		target, err := os.Readlink(filepath.Join(root, next))
+		if err != nil {
+			return "", err
+		}
+		if filepath.IsAbs(target) {
+			resolved = "/"
+		}
+		components = append(strings.Split(target, "/"), components...)
+	}
+	return filepath.Join(root, resolved), nil
+}
@@ -1,11 +1,31 @@
 package utils
 
 import (
+	"fmt"
 	"os"
 	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
 )
 
 func StopCatch(sigc chan os.Signal) {
 	signal.Stop(sigc)
 	close(sigc)
 }
+
+// ParseSignal translates a signal given by number (eg. 9) or by name,
+// with or without the SIG prefix (eg. KILL, SIGKILL), into its value.
+func ParseSignal(rawSignal string) (syscall.Signal, error) {
+	if s, err := strconv.Atoi(rawSignal); err == nil {
+		if s <= 0 || s > maxSignal {
+			return -1, fmt.Errorf("Invalid signal: %s", rawSignal)
+		}
+		return syscall.Signal(s), nil
+	}
+	s, exists := SignalMap[strings.TrimPrefix(strings.ToUpper(rawSignal), "SIG")]
+	if !exists {
+		return -1, fmt.Errorf("Invalid signal: %s", rawSignal)
+	}
+	return s, nil
+}
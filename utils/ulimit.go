@@ -0,0 +1,100 @@
+package utils
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Ulimit is a resource limit applied to the processes of a container.
+// A value of -1 means unlimited.
+type Ulimit struct {
+	Name string
+	Soft int64
+	Hard int64
+}
+
+// Linux resource numbers, as used by setrlimit(2)
+var ulimitResources = map[string]int{
+	"cpu":        0,
+	"fsize":      1,
+	"data":       2,
+	"stack":      3,
+	"core":       4,
+	"rss":        5,
+	"nproc":      6,
+	"nofile":     7,
+	"memlock":    8,
+	"as":         9,
+	"locks":      10,
+	"sigpending": 11,
+	"msgqueue":   12,
+	"nice":       13,
+	"rtprio":     14,
+	"rttime":     15,
+}
+
+func parseUlimitValue(rawValue string) (int64, error) {
+	if rawValue == "unlimited" || rawValue == "-1" {
+		return -1, nil
+	}
+	value, err := strconv.ParseInt(rawValue, 10, 64)
+	if err != nil || value < 0 {
+		return 0, fmt.Errorf("Invalid ulimit value: %s", rawValue)
+	}
+	return value, nil
+}
+
+// ParseUlimit parses a ulimit given in the format name=soft[:hard],
+// the hard limit defaulting to the soft one (eg. nofile=1024:4096).
+func ParseUlimit(rawUlimit string) (*Ulimit, error) {
+	parts := strings.SplitN(rawUlimit, "=", 2)
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("Invalid ulimit: %s (format: name=soft[:hard])", rawUlimit)
+	}
+
+	values := strings.SplitN(parts[1], ":", 2)
+	soft, err := parseUlimitValue(values[0])
+	if err != nil {
+		return nil, err
+	}
+	hard := soft
+	if len(values) == 2 {
+		if hard, err = parseUlimitValue(values[1]); err != nil {
+			return nil, err
+		}
+	}
+	ulimit := &Ulimit{Name: parts[0], Soft: soft, Hard: hard}
+	if err := ulimit.Validate(); err != nil {
+		return nil, err
+	}
+	return ulimit, nil
+}
+
+// Validate checks that the ulimit names a known resource and that its
+// soft limit doesn't exceed its hard limit.
+func (u *Ulimit) Validate() error {
+	if _, exists := ulimitResources[u.Name]; !exists {
+		return fmt.Errorf("Invalid ulimit name: %s", u.Name)
+	}
+	if u.Soft < -1 || u.Hard < -1 {
+		return fmt.Errorf("Invalid ulimit: %s (limits must be positive or -1 for unlimited)", u)
+	}
+	if u.Hard != -1 && (u.Soft == -1 || u.Soft > u.Hard) {
+		return fmt.Errorf("Invalid ulimit: %s (soft limit must not exceed the hard limit)", u)
+	}
+	return nil
+}
+
+// Resource returns the setrlimit(2) resource number of the ulimit
+func (u *Ulimit) Resource() (int, error) {
+	resource, exists := ulimitResources[u.Name]
+	if !exists {
+		return -1, fmt.Errorf("Invalid ulimit name: %s", u.Name)
+	}
+	return resource, nil
+}
+
+func (u *Ulimit) String() string {
+	return fmt.Sprintf("%s=%d:%d", u.Name, u.Soft, u.Hard)
+}
@@ -1047,7 +1047,11 @@ type User struct {
 // and returns the user struct.
 // If the username is not found, an error is returned.
 func UserLookup(uid string) (*User, error) {
-	file, err := ioutil.ReadFile("/etc/passwd")
+	return userLookup("/etc/passwd", uid)
+}
+
+func userLookup(passwdPath, uid string) (*User, error) {
+	file, err := ioutil.ReadFile(passwdPath)
 	if err != nil {
 		return nil, err
 	}
@@ -1066,6 +1070,77 @@ func UserLookup(uid string) (*User, error) {
 	return nil, fmt.Errorf("User not found in /etc/passwd")
 }
 
+type Group struct {
+	Gid     string
+	Name    string
+	Members []string // usernames of the supplementary members
+}
+
+func parseGroupFile(groupPath string) ([]*Group, error) {
+	file, err := ioutil.ReadFile(groupPath)
+	if err != nil {
+		return nil, err
+	}
+	var groups []*Group
+	for _, line := range strings.Split(string(file), "\n") {
+		data := strings.Split(line, ":")
+		if len(data) < 4 {
+			continue
+		}
+		group := &Group{Name: data[0], Gid: data[2]}
+		for _, member := range strings.Split(data[3], ",") {
+			if member = strings.TrimSpace(member); member != "" {
+				group.Members = append(group.Members, member)
+			}
+		}
+		groups = append(groups, group)
+	}
+	return groups, nil
+}
+
+// GroupLookup check if the given group name or gid is present in /etc/group
+// and returns the group struct.
+// If the group is not found, an error is returned.
+func GroupLookup(gid string) (*Group, error) {
+	return groupLookup("/etc/group", gid)
+}
+
+func groupLookup(groupPath, gid string) (*Group, error) {
+	groups, err := parseGroupFile(groupPath)
+	if err != nil {
+		return nil, err
+	}
+	for _, group := range groups {
+		if group.Name == gid || group.Gid == gid {
+			return group, nil
+		}
+	}
+	return nil, fmt.Errorf("Group not found in /etc/group")
+}
+
+// UserGroups returns the groups from /etc/group listing the given username
+// as a supplementary member.
+func UserGroups(username string) ([]*Group, error) {
+	return userGroups("/etc/group", username)
+}
+
+func userGroups(groupPath, username string) ([]*Group, error) {
+	groups, err := parseGroupFile(groupPath)
+	if err != nil {
+		return nil, err
+	}
+	var out []*Group
+	for _, group := range groups {
+		for _, member := range group.Members {
+			if member == username {
+				out = append(out, group)
+				break
+			}
+		}
+	}
+	return out, nil
+}
+
 type DependencyGraph struct {
 	nodes map[string]*DependencyNode
 }
@@ -5,7 +5,11 @@ import (
 	"errors"
 	"io"
 	"io/ioutil"
+	"os"
+	"path"
+	"strconv"
 	"strings"
+	"syscall"
 	"testing"
 )
 
@@ -515,3 +519,236 @@ func StrSlicesEqual(a, b []string) bool {
 
 	return true
 }
+
+func TestParseSignal(t *testing.T) {
+	for _, raw := range []string{"9", "KILL", "SIGKILL", "sigkill", "kill"} {
+		s, err := ParseSignal(raw)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s != syscall.SIGKILL {
+			t.Fatalf("Expected %s to be SIGKILL, got %d", raw, s)
+		}
+	}
+	if _, err := ParseSignal(strconv.Itoa(maxSignal)); err != nil {
+		t.Fatal(err)
+	}
+	for _, raw := range []string{"", "0", "-1", strconv.Itoa(maxSignal + 1), "SIGFOO"} {
+		if _, err := ParseSignal(raw); err == nil {
+			t.Fatalf("Expected %s to be invalid", raw)
+		}
+	}
+}
+
+func TestUserAndGroupLookup(t *testing.T) {
+	dir, err := ioutil.TempDir("", "TestUserAndGroupLookup")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	passwdPath := path.Join(dir, "passwd")
+	groupPath := path.Join(dir, "group")
+	passwd := "root:x:0:0:root:/root:/bin/bash\ngordon:x:1000:1000:Gordon:/home/gordon:/bin/sh\n"
+	group := "root:x:0:\ngordon:x:1000:\naudio:x:29:gordon,pulse\nvideo:x:44:\nstaff:x:50:pulse,gordon\n"
+	if err := ioutil.WriteFile(passwdPath, []byte(passwd), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(groupPath, []byte(group), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, u := range []string{"gordon", "1000"} {
+		user, err := userLookup(passwdPath, u)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if user.Uid != "1000" || user.Gid != "1000" || user.Username != "gordon" {
+			t.Fatalf("Unexpected user for %s: %v", u, user)
+		}
+	}
+	if _, err := userLookup(passwdPath, "nobody"); err == nil {
+		t.Fatal("Expected an error for an unknown user")
+	}
+
+	for _, g := range []string{"video", "44"} {
+		group, err := groupLookup(groupPath, g)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if group.Gid != "44" || group.Name != "video" {
+			t.Fatalf("Unexpected group for %s: %v", g, group)
+		}
+	}
+	if _, err := groupLookup(groupPath, "wheel"); err == nil {
+		t.Fatal("Expected an error for an unknown group")
+	}
+
+	groups, err := userGroups(groupPath, "gordon")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(groups) != 2 || groups[0].Name != "audio" || groups[1].Name != "staff" {
+		t.Fatalf("Expected gordon to be in audio and staff, got %v", groups)
+	}
+}
+
+func TestParseUlimit(t *testing.T) {
+	valid := map[string]Ulimit{
+		"nofile=1024":          {"nofile", 1024, 1024},
+		"nofile=1024:4096":     {"nofile", 1024, 4096},
+		"nproc=512:unlimited":  {"nproc", 512, -1},
+		"core=unlimited":       {"core", -1, -1},
+		"memlock=-1:unlimited": {"memlock", -1, -1},
+	}
+	for raw, expected := range valid {
+		ulimit, err := ParseUlimit(raw)
+		if err != nil {
+			t.Fatalf("Unexpected error for %s: %s", raw, err)
+		}
+		if *ulimit != expected {
+			t.Fatalf("Expected %v for %s, got %v", expected, raw, *ulimit)
+		}
+	}
+
+	invalid := []string{
+		"nofile",
+		"nofile=",
+		"nofile=a",
+		"nofile=-2",
+		"nofile=4096:1024",
+		"nofile=unlimited:1024",
+		"notalimit=1024",
+	}
+	for _, raw := range invalid {
+		if _, err := ParseUlimit(raw); err == nil {
+			t.Fatalf("Expected an error for %s", raw)
+		}
+	}
+}
+
+func TestDockerIgnore(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "docker-test-dockerignore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	if patterns, err := ReadDockerIgnore(path.Join(tmp, ".dockerignore")); err != nil || patterns != nil {
+		t.Fatalf("Expected no patterns without a .dockerignore, got %v (%v)", patterns, err)
+	}
+
+	content := "# comment\n\n.git\n/build/\n*.log\ndocs\n!docs/README.md\n"
+	if err := ioutil.WriteFile(path.Join(tmp, ".dockerignore"), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	patterns, err := ReadDockerIgnore(path.Join(tmp, ".dockerignore"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []string{".git", "build", "*.log", "docs", "!docs/README.md"}; strings.Join(patterns, " ") != strings.Join(expected, " ") {
+		t.Fatalf("Expected patterns %v, got %v", expected, patterns)
+	}
+	if !HasDockerIgnoreExceptions(patterns) {
+		t.Fatal("Expected the patterns to have exceptions")
+	}
+
+	for file, expected := range map[string]bool{
+		".git":            true,
+		".git/config":     true,
+		"build/app":       true,
+		"builder":         false,
+		"error.log":       true,
+		"logs/error.log":  false,
+		"docs/index.md":   true,
+		"docs/README.md":  false,
+		"src/main.go":     false,
+		"Dockerfile":      false,
+		"src/docs/README": false,
+	} {
+		excluded, err := MatchesDockerIgnore(file, patterns)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if excluded != expected {
+			t.Errorf("Expected %s to be excluded: %t, got %t", file, expected, excluded)
+		}
+	}
+
+	if err := ioutil.WriteFile(path.Join(tmp, ".dockerignore"), []byte("[\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReadDockerIgnore(path.Join(tmp, ".dockerignore")); err == nil {
+		t.Fatal("Expected an error for an invalid pattern")
+	}
+}
+
+func TestWalkDockerIgnore(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "docker-test-walkdockerignore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	for _, file := range []string{"build/app", "docs/index.md", "docs/README.md", "src/main.go", "src/Dockerfile.dev", "error.log"} {
+		if err := os.MkdirAll(path.Join(tmp, path.Dir(file)), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path.Join(tmp, file), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	content := "build\n*.log\ndocs\n!docs/README.md\nsrc/Dockerfile*\n.dockerignore\n"
+	if err := ioutil.WriteFile(path.Join(tmp, ".dockerignore"), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	included, excluded, err := WalkDockerIgnore(tmp, "src/Dockerfile.dev")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// With exceptions, the excluded directories are walked into
+	if expected := ".dockerignore docs/README.md src src/Dockerfile.dev src/main.go"; strings.Join(included, " ") != expected {
+		t.Fatalf("Expected %s to be included, got %v", expected, included)
+	}
+	if expected := "build/app docs/index.md error.log"; strings.Join(excluded, " ") != expected {
+		t.Fatalf("Expected %s to be excluded, got %v", expected, excluded)
+	}
+}
+
+func TestFollowSymlinkInScope(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "docker-test-symlink")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	if err := os.MkdirAll(path.Join(tmp, "etc"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for link, target := range map[string]string{"h": "/", "up": "../../..", "conf": "etc", "loop": "loop"} {
+		if err := os.Symlink(target, path.Join(tmp, link)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for pth, expected := range map[string]string{
+		"/etc/shadow":     "/etc/shadow",
+		"/h/etc/shadow":   "/etc/shadow",
+		"/up/etc/shadow":  "/etc/shadow",
+		"/../etc/shadow":  "/etc/shadow",
+		"/conf/../h/conf": "/etc",
+		"/missing/../h":   "/",
+	} {
+		resolved, err := FollowSymlinkInScope(pth, tmp)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resolved != path.Join(tmp, expected) {
+			t.Errorf("Expected %s to resolve to %s, got %s", pth, path.Join(tmp, expected), resolved)
+		}
+	}
+	if _, err := FollowSymlinkInScope("/loop", tmp); err == nil {
+		t.Fatal("Expected a symlink loop to fail")
+	}
+}
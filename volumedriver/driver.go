@@ -0,0 +1,86 @@
+package volumedriver
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"sync"
+	"time"
+)
+
+// Driver manages the storage of volumes. Volumes are identified by the
+// volume ID, and have to be mounted on the host before being bind
+// mounted into a container.
+type Driver interface {
+	String() string
+
+	Create(id string) error
+	Remove(id string) error
+
+	// Mount makes the volume available on the host and returns its path.
+	// It is called by each container using the volume when it starts, and
+	// Unmount once for each Mount: a volume shared between containers must
+	// stay mounted until its last Unmount, the driver counts its mounts.
+	Mount(id string) (string, error)
+	Unmount(id string) error
+
+	// Path returns the host path of a mounted volume
+	Path(id string) (string, error)
+}
+
+var (
+	// Directories searched for volume driver plugins: a driver named foo
+	// is either served on the unix socket foo.sock, or implemented by
+	// the executable foo.
+	PluginPaths = []string{
+		"/run/docker/volume-drivers",
+		"/etc/docker/volume-drivers",
+		"/usr/lib/docker/volume-drivers",
+	}
+
+	// How long a plugin has to complete an operation. A plugin which hangs
+	// would block the containers using its volumes.
+	Timeout = 2 * time.Minute
+
+	// All registered and discovered drivers
+	drivers = make(map[string]Driver)
+	lock    sync.Mutex
+)
+
+func Register(name string, driver Driver) error {
+	lock.Lock()
+	defer lock.Unlock()
+
+	if _, exists := drivers[name]; exists {
+		return fmt.Errorf("Name already registered %s", name)
+	}
+	drivers[name] = driver
+	return nil
+}
+
+// GetDriver returns the driver registered under name, or looks for a
+// plugin implementing it in PluginPaths.
+func GetDriver(name string) (Driver, error) {
+	lock.Lock()
+	defer lock.Unlock()
+
+	if driver, exists := drivers[name]; exists {
+		return driver, nil
+	}
+	if name == "" || path.Base(name) != name {
+		return nil, fmt.Errorf("Invalid volume driver name: %s", name)
+	}
+	for _, dir := range PluginPaths {
+		socketPath := path.Join(dir, name+".sock")
+		if fi, err := os.Stat(socketPath); err == nil && fi.Mode()&os.ModeSocket != 0 {
+			drivers[name] = NewSocketDriver(name, socketPath)
+			return drivers[name], nil
+		}
+		execPath := path.Join(dir, name)
+		if fi, err := os.Stat(execPath); err == nil && fi.Mode().IsRegular() && fi.Mode()&0111 != 0 {
+			drivers[name] = NewExecDriver(name, execPath)
+			return drivers[name], nil
+		}
+	}
+	return nil, fmt.Errorf("No such volume driver: %s", name)
+}
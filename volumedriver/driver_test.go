@@ -0,0 +1,166 @@
+package volumedriver
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path"
+	"testing"
+	"time"
+)
+
+// A volume driver storing the volumes in its own directory
+const execDriverScript = `#!/bin/sh
+root=$(dirname "$0")/data
+case "$1" in
+create) mkdir -p "$root/$2" ;;
+remove) rm -rf "$root/$2" ;;
+mount|path) [ -d "$root/$2" ] || { echo "no such volume $2" >&2; exit 1; }; echo "$root/$2" ;;
+unmount) ;;
+*) exit 1 ;;
+esac
+`
+
+func tempPluginPath(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "volumedriver")
+	if err != nil {
+		t.Fatal(err)
+	}
+	PluginPaths = []string{dir}
+	return dir
+}
+
+func TestExecDriver(t *testing.T) {
+	dir := tempPluginPath(t)
+	defer os.RemoveAll(dir)
+	if err := ioutil.WriteFile(path.Join(dir, "testexec"), []byte(execDriverScript), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	driver, err := GetDriver("testexec")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := driver.(*ExecDriver); !ok {
+		t.Fatalf("Expected an exec driver, got %T", driver)
+	}
+	if err := driver.Create("foo"); err != nil {
+		t.Fatal(err)
+	}
+	pth, err := driver.Mount("foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pth != path.Join(dir, "data", "foo") {
+		t.Fatalf("Unexpected mount path: %s", pth)
+	}
+	if err := driver.Unmount("foo"); err != nil {
+		t.Fatal(err)
+	}
+	if err := driver.Remove("foo"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := driver.Path("foo"); err == nil || err.Error() != "Volume driver testexec failed to path foo: no such volume foo" {
+		t.Fatalf("Expected the error of the driver, got %v", err)
+	}
+}
+
+func TestExecDriverTimeout(t *testing.T) {
+	dir := tempPluginPath(t)
+	defer os.RemoveAll(dir)
+	defer func(timeout time.Duration) { Timeout = timeout }(Timeout)
+	Timeout = 100 * time.Millisecond
+
+	// The child of the driver keeps its output open
+	if err := ioutil.WriteFile(path.Join(dir, "testhang"), []byte("#!/bin/sh\nsleep 10 &\nwait\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	driver, err := GetDriver("testhang")
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	if _, err := driver.Mount("foo"); err == nil || err.Error() != "Volume driver testhang failed to mount foo: timed out after 100ms" {
+		t.Fatalf("Expected the driver to time out, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("Expected the driver to be killed, it took %s", elapsed)
+	}
+}
+
+func TestSocketDriver(t *testing.T) {
+	dir := tempPluginPath(t)
+	defer os.RemoveAll(dir)
+
+	l, err := net.Listen("unix", path.Join(dir, "testsocket.sock"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	// The handlers run in their own goroutine, where t.Fatal can't be called
+	handlerErrors := make(chan error, 1)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/VolumeDriver.Mount", func(w http.ResponseWriter, r *http.Request) {
+		var req socketRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			handlerErrors <- err
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(&socketResponse{Mountpoint: "/mnt/" + req.Name})
+	})
+	mux.HandleFunc("/VolumeDriver.Remove", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(&socketResponse{Err: "volume is busy"})
+	})
+	hang := make(chan struct{})
+	defer close(hang)
+	mux.HandleFunc("/VolumeDriver.Unmount", func(w http.ResponseWriter, r *http.Request) {
+		<-hang
+	})
+	go http.Serve(l, mux)
+
+	driver, err := GetDriver("testsocket")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := driver.(*SocketDriver); !ok {
+		t.Fatalf("Expected a socket driver, got %T", driver)
+	}
+	pth, err := driver.Mount("foo")
+	select {
+	case err := <-handlerErrors:
+		t.Fatal(err)
+	default:
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pth != "/mnt/foo" {
+		t.Fatalf("Unexpected mount path: %s", pth)
+	}
+	if err := driver.Remove("foo"); err == nil || err.Error() != "Volume driver testsocket failed to remove foo: volume is busy" {
+		t.Fatalf("Expected the error of the driver, got %v", err)
+	}
+	if err := driver.Create("foo"); err == nil {
+		t.Fatal("Expected an error for an operation the driver doesn't implement")
+	}
+
+	defer func(timeout time.Duration) { Timeout = timeout }(Timeout)
+	Timeout = 100 * time.Millisecond
+	if err := driver.Unmount("foo"); err == nil {
+		t.Fatal("Expected an error when the driver doesn't answer in time")
+	}
+}
+
+func TestGetDriverNotFound(t *testing.T) {
+	dir := tempPluginPath(t)
+	defer os.RemoveAll(dir)
+
+	for _, name := range []string{"doesnotexist", "../testexec", ""} {
+		if _, err := GetDriver(name); err == nil {
+			t.Fatalf("Expected an error for the driver %q", name)
+		}
+	}
+}
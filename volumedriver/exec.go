@@ -0,0 +1,94 @@
+package volumedriver
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// ExecDriver is a volume driver implemented by an executable, called as
+//     <executable> create|remove|mount|unmount|path <id>
+// The mount and path commands print the host path of the volume on their
+// standard output. A non-zero exit status is an error, described by the
+// standard error.
+type ExecDriver struct {
+	name string
+	path string
+}
+
+func NewExecDriver(name, path string) *ExecDriver {
+	return &ExecDriver{name: name, path: path}
+}
+
+func (d *ExecDriver) String() string {
+	return d.name
+}
+
+func (d *ExecDriver) call(command, id string) (string, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(d.path, command, id)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	// In its own process group, to kill its children along with it
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	if err := cmd.Start(); err != nil {
+		return "", fmt.Errorf("Volume driver %s failed to %s %s: %s", d.name, command, id, err)
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- cmd.Wait()
+	}()
+	var err error
+	select {
+	case err = <-done:
+	case <-time.After(Timeout):
+		// Don't wait for it, a process left out of the group could keep
+		// the output open
+		syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+		return "", fmt.Errorf("Volume driver %s failed to %s %s: timed out after %s", d.name, command, id, Timeout)
+	}
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("Volume driver %s failed to %s %s: %s", d.name, command, id, msg)
+		}
+		return "", fmt.Errorf("Volume driver %s failed to %s %s: %s", d.name, command, id, err)
+	}
+	return strings.TrimSpace(stdout.String()), nil
+}
+
+func (d *ExecDriver) Create(id string) error {
+	_, err := d.call("create", id)
+	return err
+}
+
+func (d *ExecDriver) Remove(id string) error {
+	_, err := d.call("remove", id)
+	return err
+}
+
+func (d *ExecDriver) Mount(id string) (string, error) {
+	return d.callPath("mount", id)
+}
+
+func (d *ExecDriver) Unmount(id string) error {
+	_, err := d.call("unmount", id)
+	return err
+}
+
+func (d *ExecDriver) Path(id string) (string, error) {
+	return d.callPath("path", id)
+}
+
+func (d *ExecDriver) callPath(command, id string) (string, error) {
+	pth, err := d.call(command, id)
+	if err != nil {
+		return "", err
+	}
+	if !strings.HasPrefix(pth, "/") {
+		return "", fmt.Errorf("Volume driver %s returned an invalid path for %s: %q", d.name, id, pth)
+	}
+	return pth, nil
+}
@@ -0,0 +1,115 @@
+package volumedriver
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// SocketDriver is a volume driver served over HTTP on a unix socket.
+// Each operation is a POST to /VolumeDriver.<Operation> (eg.
+// /VolumeDriver.Mount) with the body {"Name": "<id>"}, answered with
+// {"Mountpoint": "<host path>", "Err": "<error message>"}.
+type SocketDriver struct {
+	name   string
+	client *http.Client
+}
+
+type socketRequest struct {
+	Name string
+}
+
+type socketResponse struct {
+	Mountpoint string
+	Err        string
+}
+
+func NewSocketDriver(name, socketPath string) *SocketDriver {
+	return &SocketDriver{
+		name: name,
+		client: &http.Client{
+			Transport: &http.Transport{
+				// Each operation gets its own connection, whose deadline
+				// bounds the whole operation
+				DisableKeepAlives: true,
+				Dial: func(proto, addr string) (net.Conn, error) {
+					conn, err := net.DialTimeout("unix", socketPath, Timeout)
+					if err != nil {
+						return nil, err
+					}
+					if err := conn.SetDeadline(time.Now().Add(Timeout)); err != nil {
+						conn.Close()
+						return nil, err
+					}
+					return conn, nil
+				},
+			},
+		},
+	}
+}
+
+func (d *SocketDriver) String() string {
+	return d.name
+}
+
+func (d *SocketDriver) call(operation, id string) (string, error) {
+	body, err := json.Marshal(&socketRequest{Name: id})
+	if err != nil {
+		return "", err
+	}
+	resp, err := d.client.Post("http://"+d.name+"/VolumeDriver."+operation, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return "", fmt.Errorf("Volume driver %s failed to %s %s: %s", d.name, strings.ToLower(operation), id, err)
+	}
+	defer resp.Body.Close()
+
+	var out socketResponse
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return "", fmt.Errorf("Volume driver %s returned an invalid response to %s: %s", d.name, operation, err)
+	}
+	if out.Err != "" {
+		return "", fmt.Errorf("Volume driver %s failed to %s %s: %s", d.name, strings.ToLower(operation), id, out.Err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("Volume driver %s failed to %s %s: %s", d.name, strings.ToLower(operation), id, resp.Status)
+	}
+	return out.Mountpoint, nil
+}
+
+func (d *SocketDriver) Create(id string) error {
+	_, err := d.call("Create", id)
+	return err
+}
+
+func (d *SocketDriver) Remove(id string) error {
+	_, err := d.call("Remove", id)
+	return err
+}
+
+func (d *SocketDriver) Mount(id string) (string, error) {
+	return d.callPath("Mount", id)
+}
+
+func (d *SocketDriver) Unmount(id string) error {
+	_, err := d.call("Unmount", id)
+	return err
+}
+
+func (d *SocketDriver) Path(id string) (string, error) {
+	return d.callPath("Path", id)
+}
+
+func (d *SocketDriver) callPath(operation, id string) (string, error) {
+	pth, err := d.call(operation, id)
+	if err != nil {
+		return "", err
+	}
+	if !strings.HasPrefix(pth, "/") {
+		return "", fmt.Errorf("Volume driver %s returned an invalid path for %s: %q", d.name, id, pth)
+	}
+	return pth, nil
+}
@@ -0,0 +1,361 @@
+package docker
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/dotcloud/docker/volumedriver"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const DefaultVolumeDriver = "local"
+
+var validVolumeName = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]*$`)
+
+// Volume is a volume managed by a volume driver. Named volumes have their
+// own lifecycle: they are only removed explicitly, never along with a
+// container. Anonymous volumes have no name.
+type Volume struct {
+	ID         string
+	Name       string `json:",omitempty"`
+	Driver     string `json:",omitempty"` // Empty for the local driver
+	Mountpoint string `json:",omitempty"` // Host path where the driver last mounted the volume, for information only
+	Created    time.Time
+}
+
+func (volume *Volume) isLocal() bool {
+	return volume.Driver == "" || volume.Driver == DefaultVolumeDriver
+}
+
+// VolumeStore keeps track of the volumes. Anonymous local volumes are
+// plain entries of the volumes graph, other volumes are recorded in the
+// store.
+type VolumeStore struct {
+	sync.Mutex
+	path    string
+	graph   *Graph
+	local   *localVolumeDriver
+	Volumes map[string]*Volume // Named or non-local volumes, by name (or ID when anonymous)
+}
+
+func NewVolumeStore(path string, graph *Graph) (*VolumeStore, error) {
+	abspath, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	store := &VolumeStore{
+		path:    abspath,
+		graph:   graph,
+		local:   &localVolumeDriver{graph: graph},
+		Volumes: make(map[string]*Volume),
+	}
+	// Load the json file if it exists, otherwise create it.
+	if err := store.reload(); os.IsNotExist(err) {
+		if err := store.save(); err != nil {
+			return nil, err
+		}
+	} else if err != nil {
+		return nil, err
+	}
+	return store, nil
+}
+
+func (store *VolumeStore) save() error {
+	jsonData, err := json.Marshal(store)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(store.path, jsonData, 0600)
+}
+
+func (store *VolumeStore) reload() error {
+	jsonData, err := ioutil.ReadFile(store.path)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(jsonData, store)
+}
+
+func (store *VolumeStore) driver(volume *Volume) (volumedriver.Driver, error) {
+	if volume.isLocal() {
+		return store.local, nil
+	}
+	return volumedriver.GetDriver(volume.Driver)
+}
+
+// Create creates a new volume with the given driver, the local one if
+// empty. An empty name creates an anonymous volume.
+func (store *VolumeStore) Create(name, driverName string) (*Volume, error) {
+	if name != "" {
+		if !validVolumeName.MatchString(name) {
+			return nil, fmt.Errorf("Invalid volume name (%s), only [a-zA-Z0-9_.-] are allowed", name)
+		}
+		store.Lock()
+		_, exists := store.Volumes[name]
+		store.Unlock()
+		if exists {
+			return nil, fmt.Errorf("Conflict, the volume %s already exists", name)
+		}
+	}
+	if driverName == DefaultVolumeDriver {
+		driverName = ""
+	}
+	volume := &Volume{
+		ID:      GenerateID(),
+		Name:    name,
+		Driver:  driverName,
+		Created: time.Now().UTC(),
+	}
+	driver, err := store.driver(volume)
+	if err != nil {
+		return nil, err
+	}
+	// Don't hold the lock while an external driver works, it would block
+	// every lookup of a volume
+	if err := driver.Create(volume.ID); err != nil {
+		return nil, err
+	}
+	if name != "" || !volume.isLocal() {
+		store.Lock()
+		defer store.Unlock()
+		// Another volume may have been given the name in the meantime
+		if _, exists := store.Volumes[volume.key()]; exists {
+			driver.Remove(volume.ID)
+			return nil, fmt.Errorf("Conflict, the volume %s already exists", name)
+		}
+		store.Volumes[volume.key()] = volume
+		if err := store.save(); err != nil {
+			return nil, err
+		}
+	}
+	return volume, nil
+}
+
+func (volume *Volume) key() string {
+	if volume.Name != "" {
+		return volume.Name
+	}
+	return volume.ID
+}
+
+// getExact looks up a volume by its exact name or full ID. The caller
+// must hold the lock of the store.
+func (store *VolumeStore) getExact(name string) *Volume {
+	if volume, exists := store.Volumes[name]; exists {
+		return volume
+	}
+	if volume := store.byID(name); volume != nil {
+		return volume
+	}
+	// Only a full ID is an exact match in the volumes graph
+	if len(name) != 64 {
+		return nil
+	}
+	img, err := store.graph.Get(name)
+	if err != nil || img.ID != name {
+		return nil
+	}
+	return &Volume{ID: img.ID, Created: img.Created}
+}
+
+// GetExact looks up a volume by its exact name or full ID, unlike Get
+// which also accepts a prefix of its ID.
+func (store *VolumeStore) GetExact(name string) (*Volume, error) {
+	store.Lock()
+	defer store.Unlock()
+
+	if volume := store.getExact(name); volume != nil {
+		return volume, nil
+	}
+	return nil, fmt.Errorf("No such volume: %s", name)
+}
+
+// Get looks up a volume by name, or by ID for anonymous volumes. A prefix
+// of an ID is accepted as long as it is the one of a single volume.
+func (store *VolumeStore) Get(name string) (*Volume, error) {
+	if volume, err := store.GetExact(name); err == nil || name == "" {
+		return volume, err
+	}
+	volumes, err := store.List()
+	if err != nil {
+		return nil, err
+	}
+	var found *Volume
+	for _, volume := range volumes {
+		if !strings.HasPrefix(volume.ID, name) {
+			continue
+		}
+		if found != nil {
+			return nil, fmt.Errorf("Conflict, the volume ID prefix %s is ambiguous", name)
+		}
+		found = volume
+	}
+	if found == nil {
+		return nil, fmt.Errorf("No such volume: %s", name)
+	}
+	return found, nil
+}
+
+// GetByPath returns the local volume stored at the given host path, or nil
+// if the path is not a local volume (eg. a bind mount). Volumes of other
+// drivers can be mounted at a different path each time, containers find
+// them by ID, see Container.volume.
+func (store *VolumeStore) GetByPath(pth string) *Volume {
+	// The path of a local volume is the one of its full ID in the volumes
+	// graph, anything else is a bind mount
+	pth = filepath.Clean(pth)
+	id := filepath.Base(strings.TrimSuffix(pth, "/layer"))
+	volume, err := store.GetExact(id)
+	if err != nil || volume.ID != id || !volume.isLocal() {
+		return nil
+	}
+	if localPath, err := store.local.Path(id); err == nil && pth == filepath.Clean(localPath) {
+		return volume
+	}
+	if pth == filepath.Join(store.graph.Root, id, "layer") {
+		return volume
+	}
+	return nil
+}
+
+func (store *VolumeStore) byID(id string) *Volume {
+	for _, volume := range store.Volumes {
+		if volume.ID == id {
+			return volume
+		}
+	}
+	return nil
+}
+
+// Path returns the host path of the volume's content
+func (store *VolumeStore) Path(volume *Volume) (string, error) {
+	driver, err := store.driver(volume)
+	if err != nil {
+		return "", err
+	}
+	return driver.Path(volume.ID)
+}
+
+// Mount asks the driver of the volume to make it available on the host,
+// and returns its host path.
+func (store *VolumeStore) Mount(volume *Volume) (string, error) {
+	driver, err := store.driver(volume)
+	if err != nil {
+		return "", err
+	}
+	pth, err := driver.Mount(volume.ID)
+	if err != nil {
+		return "", err
+	}
+	if !volume.isLocal() && volume.Mountpoint != pth {
+		store.Lock()
+		defer store.Unlock()
+		volume.Mountpoint = pth
+		if err := store.save(); err != nil {
+			return "", err
+		}
+	}
+	return pth, nil
+}
+
+func (store *VolumeStore) Unmount(volume *Volume) error {
+	driver, err := store.driver(volume)
+	if err != nil {
+		return err
+	}
+	return driver.Unmount(volume.ID)
+}
+
+// List returns all the volumes, named or not, sorted by creation date
+func (store *VolumeStore) List() ([]*Volume, error) {
+	images, err := store.graph.Map()
+	if err != nil {
+		return nil, err
+	}
+	store.Lock()
+	defer store.Unlock()
+
+	volumes := make([]*Volume, 0, len(images)+len(store.Volumes))
+	for id, img := range images {
+		if store.byID(id) == nil {
+			volumes = append(volumes, &Volume{ID: id, Created: img.Created})
+		}
+	}
+	for _, volume := range store.Volumes {
+		volumes = append(volumes, volume)
+	}
+	sort.Sort(volumesByCreation(volumes))
+	return volumes, nil
+}
+
+// Delete removes the volume and its content
+func (store *VolumeStore) Delete(volume *Volume) error {
+	driver, err := store.driver(volume)
+	if err != nil {
+		return err
+	}
+	if err := driver.Remove(volume.ID); err != nil {
+		return err
+	}
+	store.Lock()
+	defer store.Unlock()
+
+	if _, exists := store.Volumes[volume.key()]; exists {
+		delete(store.Volumes, volume.key())
+		return store.save()
+	}
+	return nil
+}
+
+type volumesByCreation []*Volume
+
+func (v volumesByCreation) Len() int           { return len(v) }
+func (v volumesByCreation) Less(i, j int) bool { return v[i].Created.Before(v[j].Created) }
+func (v volumesByCreation) Swap(i, j int)      { v[i], v[j] = v[j], v[i] }
+
+// localVolumeDriver stores the volumes as entries of the volumes graph,
+// under the runtime root.
+type localVolumeDriver struct {
+	graph *Graph
+}
+
+func (d *localVolumeDriver) String() string {
+	return DefaultVolumeDriver
+}
+
+func (d *localVolumeDriver) Create(id string) error {
+	// Do not give the volume a parent: the graph driver would use
+	// it as the base of the volume's content.
+	return d.graph.Register(nil, nil, &Image{
+		ID:            id,
+		Created:       time.Now().UTC(),
+		DockerVersion: VERSION,
+		Architecture:  "x86_64",
+	})
+}
+
+func (d *localVolumeDriver) Remove(id string) error {
+	return d.graph.Delete(id)
+}
+
+func (d *localVolumeDriver) Mount(id string) (string, error) {
+	return d.Path(id)
+}
+
+func (d *localVolumeDriver) Unmount(id string) error {
+	return nil
+}
+
+func (d *localVolumeDriver) Path(id string) (string, error) {
+	pth, err := d.graph.driver.Get(id)
+	if err != nil {
+		return "", fmt.Errorf("Driver %s failed to get volume rootfs %s: %s", d.graph.driver, id, err)
+	}
+	return pth, nil
+}
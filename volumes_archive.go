@@ -0,0 +1,399 @@
+package docker
+
+import (
+	"archive/tar"
+	"encoding/json"
+	"fmt"
+	"github.com/dotcloud/docker/archive"
+	"github.com/dotcloud/docker/utils"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// volumeArchiveEntry describes a volume of an archive made by exportVolumes.
+// Each volume is stored in its own directory, its description in "json"
+// and its content under "layer/".
+type volumeArchiveEntry struct {
+	Path   string // Mountpoint inside the container
+	RW     bool
+	Name   string `json:",omitempty"` // Set for named volumes
+	Driver string `json:",omitempty"`
+}
+
+// The paths an archive can't restore a volume at: the filesystems lxc
+// mounts, reserved along with everything under them (true), and the files
+// docker bind mounts into the container.
+var reservedVolumePaths = map[string]bool{
+	"/proc":            true,
+	"/sys":             true,
+	"/dev":             true,
+	"/etc":             false,
+	"/etc/hostname":    false,
+	"/etc/hosts":       false,
+	"/etc/resolv.conf": false,
+	"/.dockerinit":     false,
+	"/.dockerenv":      false,
+}
+
+// validateVolumeArchivePath checks that an archive restores a volume at
+// volPath, an absolute and clean path, without hiding a path docker
+// sets up in the container.
+func validateVolumeArchivePath(volPath string) error {
+	if !path.IsAbs(volPath) || volPath == "/" {
+		return fmt.Errorf("Invalid volume path in archive: %s", volPath)
+	}
+	for p := volPath; p != "/"; p = path.Dir(p) {
+		if recursive, reserved := reservedVolumePaths[p]; reserved && (recursive || p == volPath) {
+			return fmt.Errorf("Invalid volume path in archive: %s is reserved", volPath)
+		}
+	}
+	return nil
+}
+
+// exportVolumes writes the volumes of the container mounted at the given
+// paths, or all of them if there are none, to tw under the directory dir.
+// Bind mounts from the host are not volumes and are left out.
+func (container *Container) exportVolumes(tw *tar.Writer, dir string, paths []string) error {
+	if len(paths) == 0 {
+		for volPath := range container.Volumes {
+			if container.volume(volPath) != nil {
+				paths = append(paths, volPath)
+			}
+		}
+		sort.Strings(paths)
+	}
+	for i, volPath := range paths {
+		volPath = path.Clean(volPath)
+		if _, exists := container.Volumes[volPath]; !exists {
+			return fmt.Errorf("No such volume %s in container %s", volPath, utils.TruncateID(container.ID))
+		}
+		volume := container.volume(volPath)
+		if volume == nil {
+			return fmt.Errorf("Impossible to export %s of container %s, it is a bind mount from the host", volPath, utils.TruncateID(container.ID))
+		}
+		entry := &volumeArchiveEntry{
+			Path:   volPath,
+			RW:     container.VolumesRW[volPath],
+			Name:   volume.Name,
+			Driver: volume.Driver,
+		}
+
+		entryDir := path.Join(dir, strconv.Itoa(i))
+		jsonData, err := json.Marshal(entry)
+		if err != nil {
+			return err
+		}
+		if err := writeTarFile(tw, path.Join(entryDir, "json"), jsonData); err != nil {
+			return err
+		}
+		// The container may not have the volume mounted, or not at this path
+		srcPath, err := container.runtime.volumeStore.Mount(volume)
+		if err != nil {
+			return err
+		}
+		fs, err := archive.Tar(srcPath, archive.Uncompressed)
+		if err == nil {
+			err = copyTarEntries(tw, path.Join(entryDir, "layer"), fs)
+		}
+		if unmountErr := container.runtime.volumeStore.Unmount(volume); err == nil {
+			err = unmountErr
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// importVolumes restores the volumes of an archive made by exportVolumes.
+// The volumes are created with the default driver, unless keepDrivers is
+// set to use the ones the archive names.
+func (container *Container) importVolumes(in io.Reader, keepDrivers bool) error {
+	importer, err := container.newVolumeImporter(keepDrivers)
+	if err != nil {
+		return err
+	}
+	if err := container.EnsureMounted(); err != nil {
+		return err
+	}
+	defer container.Unmount()
+
+	tr := tar.NewReader(in)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err == nil {
+			err = importer.add(hdr, tr)
+		}
+		if err != nil {
+			importer.abort()
+			return err
+		}
+	}
+	return importer.close()
+}
+
+// volumeImporter restores the volumes of an archive made by exportVolumes
+// as its entries are read. The content of a volume is unpacked in the
+// volume the container already mounts at its path, or in a new volume
+// otherwise. The container must be mounted.
+type volumeImporter struct {
+	container   *Container
+	keepDrivers bool         // Create the volumes with the driver of the archive
+	entryDir    string       // Directory of the volume being restored
+	srcPath     string       // Host path of the volume being restored
+	layer       *untarStream // Unpacks the content of the volume being restored
+	added       []string     // The paths of the volumes added to the container
+	created     []*Volume    // The volumes created, removed if the import fails
+	mounted     []*Volume    // The volumes mounted to be restored, unmounted at the end
+}
+
+func (container *Container) newVolumeImporter(keepDrivers bool) (*volumeImporter, error) {
+	if container.State.IsRunning() {
+		return nil, fmt.Errorf("Impossible to import volumes into the running container %s, stop it first", utils.TruncateID(container.ID))
+	}
+	if container.Volumes == nil {
+		container.Volumes = make(map[string]string)
+		container.VolumesRW = make(map[string]bool)
+	}
+	if container.VolumeIDs == nil {
+		container.VolumeIDs = make(map[string]string)
+	}
+	return &volumeImporter{container: container, keepDrivers: keepDrivers}, nil
+}
+
+// add restores an entry of the archive, named relative to its root. The
+// description of a volume must come before its content.
+func (importer *volumeImporter) add(hdr *tar.Header, r io.Reader) error {
+	name := path.Clean(hdr.Name)
+	entryDir := strings.SplitN(name, "/", 2)[0]
+	switch {
+	case name == entryDir && hdr.Typeflag == tar.TypeDir:
+		return nil
+	case name == path.Join(entryDir, "json"):
+		return importer.addVolume(entryDir, r)
+	case entryDir == importer.entryDir && trimTarEntry(hdr, path.Join(entryDir, "layer")):
+		if importer.layer == nil {
+			srcPath := importer.srcPath
+			importer.layer = newUntarStream(func(layer io.Reader) error {
+				return archive.Untar(layer, srcPath, nil)
+			})
+		}
+		return importer.layer.add(hdr, r)
+	}
+	return fmt.Errorf("Invalid volume archive: unexpected entry %s", hdr.Name)
+}
+
+func (importer *volumeImporter) addVolume(entryDir string, r io.Reader) error {
+	if err := importer.closeLayer(); err != nil {
+		return err
+	}
+	var entry volumeArchiveEntry
+	if err := json.NewDecoder(r).Decode(&entry); err != nil {
+		return err
+	}
+	volPath := path.Clean(entry.Path)
+	if err := validateVolumeArchivePath(volPath); err != nil {
+		return err
+	}
+
+	container := importer.container
+	volume := container.volume(volPath)
+	if _, exists := container.Volumes[volPath]; exists && volume == nil {
+		return fmt.Errorf("Impossible to import %s into container %s, it is a bind mount from the host", volPath, utils.TruncateID(container.ID))
+	}
+	if volume == nil {
+		// A driver runs as root on the host, the archive doesn't choose it
+		driver := ""
+		if importer.keepDrivers {
+			driver = entry.Driver
+		}
+		var err error
+		if volume, err = container.runtime.volumeStore.Create(entry.Name, driver); err != nil {
+			return err
+		}
+		importer.created = append(importer.created, volume)
+		// Create the mountpoint, as Start only does it for the volumes it creates
+		if err := os.MkdirAll(path.Join(container.RootfsPath(), volPath), 0755); err != nil {
+			return err
+		}
+		importer.added = append(importer.added, volPath)
+	}
+	// Start mounts the volumes again, the driver may choose another path
+	srcPath, err := container.runtime.volumeStore.Mount(volume)
+	if err != nil {
+		return err
+	}
+	importer.mounted = append(importer.mounted, volume)
+	container.Volumes[volPath] = srcPath
+	container.VolumeIDs[volPath] = volume.ID
+	container.VolumesRW[volPath] = entry.RW
+	importer.entryDir, importer.srcPath = entryDir, srcPath
+	return nil
+}
+
+func (importer *volumeImporter) closeLayer() error {
+	if importer.layer == nil {
+		return nil
+	}
+	err := importer.layer.close()
+	importer.layer = nil
+	return err
+}
+
+// close waits for the last volume to be unpacked and saves the container
+func (importer *volumeImporter) close() error {
+	if err := importer.closeLayer(); err != nil {
+		importer.abort()
+		return err
+	}
+	importer.unmount()
+	return importer.container.ToDisk()
+}
+
+func (importer *volumeImporter) unmount() {
+	for _, volume := range importer.mounted {
+		if err := importer.container.runtime.volumeStore.Unmount(volume); err != nil {
+			utils.Errorf("Unable to unmount the volume %s: %s", volume.ID, err)
+		}
+	}
+	importer.mounted = nil
+}
+
+// abort removes the volumes added to the container and the ones created
+func (importer *volumeImporter) abort() {
+	importer.closeLayer()
+	importer.unmount()
+	for _, volPath := range importer.added {
+		delete(importer.container.Volumes, volPath)
+		delete(importer.container.VolumesRW, volPath)
+		delete(importer.container.VolumeIDs, volPath)
+	}
+	for _, volume := range importer.created {
+		if err := importer.container.runtime.volumeStore.Delete(volume); err != nil {
+			utils.Errorf("Unable to remove the volume %s: %s", volume.ID, err)
+		}
+	}
+	importer.added, importer.created = nil, nil
+}
+
+// writeTarFile writes a regular file with the given content to tw
+func writeTarFile(tw *tar.Writer, name string, data []byte) error {
+	hdr := &tar.Header{
+		Name:     name,
+		Mode:     0600,
+		Size:     int64(len(data)),
+		ModTime:  time.Now(),
+		Typeflag: tar.TypeReg,
+	}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	_, err := tw.Write(data)
+	return err
+}
+
+// copyTarEntries copies the entries of the archive src to tw, under the
+// directory dir, without buffering them.
+func copyTarEntries(tw *tar.Writer, dir string, src io.Reader) error {
+	tr := tar.NewReader(src)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		hdr.Name = path.Join(dir, hdr.Name)
+		if hdr.Typeflag == tar.TypeDir {
+			hdr.Name += "/"
+		}
+		if hdr.Typeflag == tar.TypeLink {
+			hdr.Linkname = path.Join(dir, hdr.Linkname)
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if _, err := io.Copy(tw, tr); err != nil {
+			return err
+		}
+	}
+}
+
+// trimTarEntry moves an entry of an archive written by copyTarEntries
+// back to the root of the archive it was copied from. It returns false if
+// the entry isn't under the directory dir.
+func trimTarEntry(hdr *tar.Header, dir string) bool {
+	trim := func(name string) (string, bool) {
+		name = path.Clean(name)
+		if name == dir {
+			return ".", true
+		}
+		if strings.HasPrefix(name, dir+"/") {
+			return "./" + strings.TrimPrefix(name, dir+"/"), true
+		}
+		return "", false
+	}
+	name, ok := trim(hdr.Name)
+	if !ok {
+		return false
+	}
+	if hdr.Typeflag == tar.TypeLink {
+		if hdr.Linkname, ok = trim(hdr.Linkname); !ok {
+			return false
+		}
+	}
+	hdr.Name = name
+	return true
+}
+
+// untarStream unpacks the entries added to it as they come, with a
+// function such as archive.Untar reading them as a tar archive.
+type untarStream struct {
+	tw   *tar.Writer
+	pw   *io.PipeWriter
+	done chan error
+}
+
+func newUntarStream(unpack func(io.Reader) error) *untarStream {
+	pr, pw := io.Pipe()
+	stream := &untarStream{
+		tw:   tar.NewWriter(pw),
+		pw:   pw,
+		done: make(chan error, 1),
+	}
+	go func() {
+		err := unpack(pr)
+		// Don't leave the writer blocked if unpacking stopped early
+		pr.CloseWithError(err)
+		stream.done <- err
+	}()
+	return stream
+}
+
+func (stream *untarStream) add(hdr *tar.Header, r io.Reader) error {
+	if err := stream.tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	_, err := io.Copy(stream.tw, r)
+	return err
+}
+
+// close ends the archive and waits for it to be unpacked
+func (stream *untarStream) close() error {
+	err := stream.tw.Close()
+	stream.pw.CloseWithError(err)
+	// The error of unpacking explains the one of writing, if any
+	if unpackErr := <-stream.done; unpackErr != nil {
+		return unpackErr
+	}
+	return err
+}
@@ -0,0 +1,148 @@
+package docker
+
+import (
+	"archive/tar"
+	"bytes"
+	"github.com/dotcloud/docker/archive"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+func TestTarEntriesRoundTrip(t *testing.T) {
+	src, err := ioutil.TempDir("", "TestTarEntriesRoundTrip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(src)
+	if err := os.MkdirAll(path.Join(src, "dir"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path.Join(src, "dir", "hello"), []byte("hello\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Link(path.Join(src, "dir", "hello"), path.Join(src, "link")); err != nil {
+		t.Fatal(err)
+	}
+
+	// Two copies of the directory in the same archive
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, dir := range []string{"0/layer", "1/layer"} {
+		fs, err := archive.Tar(src, archive.Uncompressed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := copyTarEntries(tw, dir, fs); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	dst, err := ioutil.TempDir("", "TestTarEntriesRoundTrip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dst)
+	stream := newUntarStream(func(r io.Reader) error {
+		return archive.Untar(r, dst, nil)
+	})
+	tr := tar.NewReader(&buf)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !trimTarEntry(hdr, "1/layer") {
+			continue
+		}
+		if err := stream.add(hdr, tr); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := stream.close(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"dir/hello", "link"} {
+		content, err := ioutil.ReadFile(path.Join(dst, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(content) != "hello\n" {
+			t.Fatalf("Unexpected content of %s: %q", name, content)
+		}
+	}
+	if _, err := os.Stat(path.Join(dst, "1")); !os.IsNotExist(err) {
+		t.Fatalf("Expected the entries to be unpacked at the root, got %v", err)
+	}
+}
+
+func TestUntarStreamError(t *testing.T) {
+	dst, err := ioutil.TempDir("", "TestUntarStreamError")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dst)
+	// Unpacking into a missing directory fails, which is reported on close
+	stream := newUntarStream(func(r io.Reader) error {
+		return archive.Untar(r, path.Join(dst, "missing"), nil)
+	})
+	hdr := &tar.Header{Name: "./hello", Mode: 0644, Size: 6, Typeflag: tar.TypeReg}
+	stream.add(hdr, bytes.NewReader([]byte("hello\n")))
+	if err := stream.close(); err == nil {
+		t.Fatal("Expected the error of unpacking")
+	}
+}
+
+func TestVolumeImporterAddVolume(t *testing.T) {
+	root, err := ioutil.TempDir("", "TestVolumeImporterAddVolume")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	container := &Container{
+		runtime: &Runtime{volumeStore: tempVolumeStore(t, root)},
+		rootfs:  path.Join(root, "rootfs"),
+	}
+	importer, err := container.newVolumeImporter(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, volPath := range []string{"data", "/", "/proc", "/dev/shm", "/etc", "/etc/hosts", "/.dockerinit"} {
+		entry := `{"Path":"` + volPath + `"}`
+		if err := importer.addVolume("0", strings.NewReader(entry)); err == nil {
+			t.Errorf("Expected an archive restoring a volume at %s to be rejected", volPath)
+		}
+	}
+
+	// The driver recorded in the archive is ignored
+	entry := `{"Path":"/etc/app","RW":true,"Driver":"doesnotexist"}`
+	if err := importer.addVolume("0", strings.NewReader(entry)); err != nil {
+		t.Fatal(err)
+	}
+	if volume := container.volume("/etc/app"); volume == nil || volume.Driver != "" || !container.VolumesRW["/etc/app"] {
+		t.Fatalf("Expected a read-write local volume at /etc/app, got %v", volume)
+	}
+	importer.abort()
+	if _, exists := container.Volumes["/etc/app"]; exists {
+		t.Fatal("Expected the volume to be removed from the container")
+	}
+
+	importer, err = container.newVolumeImporter(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := importer.addVolume("0", strings.NewReader(entry)); err == nil {
+		t.Fatal("Expected the unknown driver of the archive to be used")
+	}
+}
@@ -0,0 +1,268 @@
+package docker
+
+import (
+	"fmt"
+	"github.com/dotcloud/docker/graphdriver"
+	"github.com/dotcloud/docker/volumedriver"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+func tempVolumeStore(t *testing.T, root string) *VolumeStore {
+	driver, err := graphdriver.GetDriver("vfs", root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	graph, err := NewGraph(path.Join(root, "volumes"), driver)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store, err := NewVolumeStore(path.Join(root, "volumes.json"), graph)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return store
+}
+
+func TestVolumeStore(t *testing.T) {
+	root, err := ioutil.TempDir("", "TestVolumeStore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	store := tempVolumeStore(t, root)
+	named, err := store.Create("data", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	anonymous, err := store.Create("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Create("data", ""); err == nil {
+		t.Fatal("Expected an error when creating a volume twice")
+	}
+	if _, err := store.Create("-data", ""); err == nil {
+		t.Fatal("Expected an error for an invalid volume name")
+	}
+
+	// Names are persisted
+	store = tempVolumeStore(t, root)
+	volume, err := store.Get("data")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if volume.ID != named.ID {
+		t.Fatalf("Expected volume %s, got %s", named.ID, volume.ID)
+	}
+	if volume, err := store.Get(anonymous.ID); err != nil || volume.Name != "" {
+		t.Fatalf("Expected the anonymous volume %s, got %v (%v)", anonymous.ID, volume, err)
+	}
+
+	pth, err := store.Path(volume)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := store.GetByPath(pth); v == nil || v.Name != "data" {
+		t.Fatalf("Expected the path %s to be the volume data, got %v", pth, v)
+	}
+	if v := store.GetByPath("/etc"); v != nil {
+		t.Fatalf("Expected /etc not to be a volume, got %v", v)
+	}
+
+	volumes, err := store.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(volumes) != 2 {
+		t.Fatalf("Expected 2 volumes, got %d", len(volumes))
+	}
+
+	if err := store.Delete(volume); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Get("data"); err == nil {
+		t.Fatal("Expected the volume data to be removed")
+	}
+	if _, err := os.Stat(pth); !os.IsNotExist(err) {
+		t.Fatalf("Expected the content of the volume to be removed: %v", err)
+	}
+}
+
+func TestVolumeStoreDriver(t *testing.T) {
+	root, err := ioutil.TempDir("", "TestVolumeStoreDriver")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	// A volume driver storing the volumes in its own directory
+	script := "#!/bin/sh\nmkdir -p " + root + "/driver/$2\n[ $1 = mount -o $1 = path ] && echo " + root + "/driver/$2\n[ $1 = remove ] && rm -rf " + root + "/driver/$2\nexit 0\n"
+	if err := ioutil.WriteFile(path.Join(root, "testdriver"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	pluginPaths := volumedriver.PluginPaths
+	volumedriver.PluginPaths = []string{root}
+	defer func() { volumedriver.PluginPaths = pluginPaths }()
+
+	store := tempVolumeStore(t, root)
+	if _, err := store.Create("data", "doesnotexist"); err == nil {
+		t.Fatal("Expected an error for an unknown volume driver")
+	}
+	volume, err := store.Create("data", "testdriver")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pth, err := store.Mount(volume)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pth != path.Join(root, "driver", volume.ID) {
+		t.Fatalf("Unexpected mount path: %s", pth)
+	}
+
+	// The driver is persisted. Its mountpoint can change, so it doesn't
+	// identify the volume.
+	store = tempVolumeStore(t, root)
+	if v, err := store.Get("data"); err != nil || v.Driver != "testdriver" {
+		t.Fatalf("Expected the volume data of testdriver, got %v (%v)", v, err)
+	}
+	if v := store.GetByPath(pth); v != nil {
+		t.Fatalf("Expected only local volumes to be found by path, got %v", v)
+	}
+	volumes, err := store.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(volumes) != 1 || volumes[0].ID != volume.ID {
+		t.Fatalf("Expected the volume data only, got %v", volumes)
+	}
+
+	if err := store.Delete(volume); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(pth); !os.IsNotExist(err) {
+		t.Fatalf("Expected the driver to remove the volume: %v", err)
+	}
+	if _, err := store.Get("data"); err == nil {
+		t.Fatal("Expected the volume data to be removed")
+	}
+}
+
+func TestVolumeStoreExactLookup(t *testing.T) {
+	root, err := ioutil.TempDir("", "TestVolumeStoreExactLookup")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	store := tempVolumeStore(t, root)
+	anonymous, err := store.Create("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A new named volume must not resolve to the volume its name prefixes
+	if volume, err := store.GetExact(anonymous.ID[:4]); err == nil {
+		t.Fatalf("Expected %s not to be a volume, got %s", anonymous.ID[:4], volume.ID)
+	}
+	if volume, err := store.GetExact(anonymous.ID); err != nil || volume.ID != anonymous.ID {
+		t.Fatalf("Expected the full ID to be found, got %v (%v)", volume, err)
+	}
+
+	// Bind mounts are not volumes, even when named like one
+	for _, pth := range []string{"/srv/" + anonymous.ID[:3], "/srv/" + anonymous.ID, path.Join("/srv", anonymous.ID, "layer")} {
+		if volume := store.GetByPath(pth); volume != nil {
+			t.Fatalf("Expected %s not to be a volume, got %s", pth, volume.ID)
+		}
+	}
+	pth, err := store.Path(anonymous)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if volume := store.GetByPath(pth); volume == nil || volume.ID != anonymous.ID {
+		t.Fatalf("Expected %s to be the volume %s, got %v", pth, anonymous.ID, volume)
+	}
+}
+
+func TestVolumeStorePrefixLookup(t *testing.T) {
+	root, err := ioutil.TempDir("", "TestVolumeStorePrefixLookup")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	store := tempVolumeStore(t, root)
+	// With 17 volumes, at least 2 IDs start with the same hex digit
+	byDigit := make(map[byte][]*Volume)
+	for i := 0; i < 17; i++ {
+		name := ""
+		if i%2 == 0 {
+			name = fmt.Sprintf("data%d", i)
+		}
+		volume, err := store.Create(name, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		byDigit[volume.ID[0]] = append(byDigit[volume.ID[0]], volume)
+	}
+	for digit, volumes := range byDigit {
+		prefix := string(digit)
+		volume, err := store.Get(prefix)
+		if len(volumes) > 1 {
+			if err == nil || !strings.Contains(err.Error(), "ambiguous") {
+				t.Fatalf("Expected %s to be ambiguous, got %v (%v)", prefix, volume, err)
+			}
+		} else if err != nil || volume.ID != volumes[0].ID {
+			t.Fatalf("Expected %s to be the volume %s, got %v (%v)", prefix, volumes[0].ID, volume, err)
+		}
+		for _, expected := range volumes {
+			if volume, err := store.Get(expected.ID[:12]); err != nil || volume.ID != expected.ID {
+				t.Fatalf("Expected %s to be the volume %s, got %v (%v)", expected.ID[:12], expected.ID, volume, err)
+			}
+		}
+	}
+}
+
+func TestContainerVolume(t *testing.T) {
+	root, err := ioutil.TempDir("", "TestContainerVolume")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	store := tempVolumeStore(t, root)
+	named, err := store.Create("data", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	anonymous, err := store.Create("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	anonymousPath, err := store.Path(anonymous)
+	if err != nil {
+		t.Fatal(err)
+	}
+	container := &Container{
+		runtime: &Runtime{volumeStore: store},
+		Volumes: map[string]string{
+			// A driver may have mounted the volume elsewhere since
+			"/data": "/mnt/previous/mountpoint",
+			// Recorded before the volume IDs were
+			"/cache": anonymousPath,
+			"/host":  "/etc",
+		},
+		VolumeIDs: map[string]string{"/data": named.ID},
+	}
+	for volPath, expected := range map[string]*Volume{"/data": named, "/cache": anonymous, "/host": nil} {
+		volume := container.volume(volPath)
+		if (volume == nil) != (expected == nil) || volume != nil && volume.ID != expected.ID {
+			t.Errorf("Expected %v at %s, got %v", expected, volPath, volume)
+		}
+	}
+}